@@ -1,12 +1,20 @@
 package ast
 
 import (
+	"math/big"
+	"strconv"
+	"strings"
+
 	"github.com/dgnorton/monkey/lexer"
 )
 
 // Node represents a node in the AST. All nodes implement this interface.
+// A node spans the source from Pos up to but not including End.
 type Node interface {
 	TokenLiteral() string
+	String() string
+	Pos() lexer.Pos
+	End() lexer.Pos
 }
 
 // Statement represents a statement in the AST. All statement nodes
@@ -47,11 +55,36 @@ func (p *Program) TokenLiteral() string {
 	return p.Statements[0].TokenLiteral()
 }
 
+// Pos returns the start position of the first statement.
+func (p *Program) Pos() lexer.Pos {
+	if len(p.Statements) == 0 {
+		return lexer.Pos{}
+	}
+	return p.Statements[0].Pos()
+}
+
+// End returns the end position of the last statement.
+func (p *Program) End() lexer.Pos {
+	if len(p.Statements) == 0 {
+		return lexer.Pos{}
+	}
+	return p.Statements[len(p.Statements)-1].End()
+}
+
+func (p *Program) String() string {
+	var sb strings.Builder
+	for _, stmt := range p.Statements {
+		sb.WriteString(stmt.String())
+	}
+	return sb.String()
+}
+
 // LetStmt is a let statement node.
 type LetStmt struct {
-	Token *lexer.Token
-	Name  *IdentExpr
-	Value Expression
+	Token     *lexer.Token
+	Name      *IdentExpr
+	Value     Expression
+	Semicolon *lexer.Token // nil if the ";" was omitted
 }
 
 // NewLetStmt returns a new LetStmt.
@@ -65,6 +98,130 @@ func NewLetStmt(t *lexer.Token, name *IdentExpr, value Expression) *LetStmt {
 
 func (stmt *LetStmt) statement()           {}
 func (stmt *LetStmt) TokenLiteral() string { return stmt.Token.String }
+func (stmt *LetStmt) Pos() lexer.Pos       { return stmt.Token.Pos() }
+
+func (stmt *LetStmt) End() lexer.Pos {
+	if stmt.Semicolon != nil {
+		return stmt.Semicolon.End()
+	}
+	return stmt.Value.End()
+}
+
+func (stmt *LetStmt) String() string {
+	return stmt.TokenLiteral() + " " + stmt.Name.String() + " = " + stmt.Value.String() + ";"
+}
+
+// ReturnStmt is a return statement node. Value is nil for a bare "return;".
+type ReturnStmt struct {
+	Token     *lexer.Token
+	Value     Expression
+	Semicolon *lexer.Token // nil if the ";" was omitted
+}
+
+// NewReturnStmt returns a new ReturnStmt.
+func NewReturnStmt(t *lexer.Token, value Expression) *ReturnStmt {
+	return &ReturnStmt{
+		Token: t,
+		Value: value,
+	}
+}
+
+func (stmt *ReturnStmt) statement()           {}
+func (stmt *ReturnStmt) TokenLiteral() string { return stmt.Token.String }
+func (stmt *ReturnStmt) Pos() lexer.Pos       { return stmt.Token.Pos() }
+
+func (stmt *ReturnStmt) End() lexer.Pos {
+	switch {
+	case stmt.Semicolon != nil:
+		return stmt.Semicolon.End()
+	case stmt.Value != nil:
+		return stmt.Value.End()
+	default:
+		return stmt.Token.End()
+	}
+}
+
+func (stmt *ReturnStmt) String() string {
+	if stmt.Value == nil {
+		return stmt.TokenLiteral() + ";"
+	}
+	return stmt.TokenLiteral() + " " + stmt.Value.String() + ";"
+}
+
+// ExpressionStmt is a statement consisting of a single expression, e.g.,
+// "x + 1;".
+type ExpressionStmt struct {
+	Token      *lexer.Token
+	Expression Expression
+	Semicolon  *lexer.Token // nil if the ";" was omitted
+}
+
+// NewExpressionStmt returns a new ExpressionStmt.
+func NewExpressionStmt(t *lexer.Token, expr Expression) *ExpressionStmt {
+	return &ExpressionStmt{
+		Token:      t,
+		Expression: expr,
+	}
+}
+
+func (stmt *ExpressionStmt) statement()           {}
+func (stmt *ExpressionStmt) TokenLiteral() string { return stmt.Token.String }
+func (stmt *ExpressionStmt) String() string       { return stmt.Expression.String() + ";" }
+func (stmt *ExpressionStmt) Pos() lexer.Pos       { return stmt.Expression.Pos() }
+
+func (stmt *ExpressionStmt) End() lexer.Pos {
+	if stmt.Semicolon != nil {
+		return stmt.Semicolon.End()
+	}
+	return stmt.Expression.End()
+}
+
+// BlockStatement is a brace delimited list of statements, e.g., a function
+// body.
+type BlockStatement struct {
+	Token      *lexer.Token
+	Statements []Statement
+	Rbrace     *lexer.Token // nil for the implicit block of an "else if"
+}
+
+// NewBlockStatement returns a new BlockStatement.
+func NewBlockStatement(t *lexer.Token) *BlockStatement {
+	return &BlockStatement{
+		Token:      t,
+		Statements: []Statement{},
+	}
+}
+
+// AddStmt adds a statement to the block.
+func (stmt *BlockStatement) AddStmt(s Statement) {
+	stmt.Statements = append(stmt.Statements, s)
+}
+
+func (stmt *BlockStatement) statement()           {}
+func (stmt *BlockStatement) TokenLiteral() string { return stmt.Token.String }
+func (stmt *BlockStatement) Pos() lexer.Pos       { return stmt.Token.Pos() }
+
+func (stmt *BlockStatement) End() lexer.Pos {
+	switch {
+	case stmt.Rbrace != nil:
+		return stmt.Rbrace.End()
+	case len(stmt.Statements) > 0:
+		return stmt.Statements[len(stmt.Statements)-1].End()
+	default:
+		return stmt.Token.End()
+	}
+}
+
+func (stmt *BlockStatement) String() string {
+	var sb strings.Builder
+	sb.WriteString("{ ")
+	for _, s := range stmt.Statements {
+		sb.WriteString(s.String())
+		sb.WriteString(" ")
+	}
+	sb.WriteString("}")
+	return sb.String()
+}
 
 // IdentExpr is an identifier expression. There are places where
 // identifiers are used as statements but this will be used in both.
@@ -83,3 +240,401 @@ func NewIdentExpr(t *lexer.Token) *IdentExpr {
 
 func (expr *IdentExpr) expression()          {}
 func (expr *IdentExpr) TokenLiteral() string { return expr.Token.String }
+func (expr *IdentExpr) Pos() lexer.Pos       { return expr.Token.Pos() }
+func (expr *IdentExpr) End() lexer.Pos       { return expr.Token.End() }
+func (expr *IdentExpr) String() string       { return expr.Value }
+
+// IntExpr is an integer literal expression.
+type IntExpr struct {
+	Token *lexer.Token
+	Value int
+	Big   *big.Int // set instead of Value if the literal doesn't fit in an int
+}
+
+// NewIntExpr returns a new IntExpr.
+func NewIntExpr(t *lexer.Token) *IntExpr {
+	return &IntExpr{
+		Token: t,
+		Value: t.Int,
+		Big:   t.Big,
+	}
+}
+
+func (expr *IntExpr) expression()          {}
+func (expr *IntExpr) TokenLiteral() string { return expr.Token.String }
+func (expr *IntExpr) Pos() lexer.Pos       { return expr.Token.Pos() }
+func (expr *IntExpr) End() lexer.Pos       { return expr.Token.End() }
+func (expr *IntExpr) String() string       { return expr.Token.String }
+
+// FloatLiteral is a floating-point literal expression.
+type FloatLiteral struct {
+	Token *lexer.Token
+	Value float64
+}
+
+// NewFloatLiteral returns a new FloatLiteral.
+func NewFloatLiteral(t *lexer.Token) *FloatLiteral {
+	return &FloatLiteral{
+		Token: t,
+		Value: t.Float,
+	}
+}
+
+func (expr *FloatLiteral) expression()          {}
+func (expr *FloatLiteral) TokenLiteral() string { return expr.Token.String }
+func (expr *FloatLiteral) Pos() lexer.Pos       { return expr.Token.Pos() }
+func (expr *FloatLiteral) End() lexer.Pos       { return expr.Token.End() }
+func (expr *FloatLiteral) String() string       { return expr.Token.String }
+
+// StringLiteral is a string literal expression.
+type StringLiteral struct {
+	Token *lexer.Token
+	Value string
+}
+
+// NewStringLiteral returns a new StringLiteral.
+func NewStringLiteral(t *lexer.Token) *StringLiteral {
+	return &StringLiteral{
+		Token: t,
+		Value: t.String,
+	}
+}
+
+func (expr *StringLiteral) expression()          {}
+func (expr *StringLiteral) TokenLiteral() string { return expr.Token.String }
+func (expr *StringLiteral) Pos() lexer.Pos       { return expr.Token.Pos() }
+func (expr *StringLiteral) End() lexer.Pos       { return expr.Token.End() }
+func (expr *StringLiteral) String() string       { return strconv.Quote(expr.Value) }
+
+// TemplateLiteral is a template literal expression, e.g., `a ${b} c`. Its
+// parts alternate between the literal text, as StringLiterals holding the
+// template's TEMPLATE* tokens, and the embedded expressions. The first and
+// last parts are always text, which may be empty.
+type TemplateLiteral struct {
+	Token *lexer.Token
+	Parts []Expression
+}
+
+// NewTemplateLiteral returns a new TemplateLiteral.
+func NewTemplateLiteral(t *lexer.Token, parts []Expression) *TemplateLiteral {
+	return &TemplateLiteral{
+		Token: t,
+		Parts: parts,
+	}
+}
+
+func (expr *TemplateLiteral) expression()          {}
+func (expr *TemplateLiteral) TokenLiteral() string { return expr.Token.String }
+func (expr *TemplateLiteral) Pos() lexer.Pos       { return expr.Token.Pos() }
+func (expr *TemplateLiteral) End() lexer.Pos       { return expr.Parts[len(expr.Parts)-1].End() }
+
+func (expr *TemplateLiteral) String() string {
+	var sb strings.Builder
+	sb.WriteByte('`')
+	for i, part := range expr.Parts {
+		if i%2 == 0 {
+			sb.WriteString(templateEscaper.Replace(part.(*StringLiteral).Value))
+			continue
+		}
+		sb.WriteString("${" + part.String() + "}")
+	}
+	sb.WriteByte('`')
+	return sb.String()
+}
+
+// templateEscaper escapes the characters that can't appear literally in
+// the text of a template literal.
+var templateEscaper = strings.NewReplacer("\\", "\\\\", "`", "\\`", "${", "\\${")
+
+// BoolExpr is a boolean literal expression.
+type BoolExpr struct {
+	Token *lexer.Token
+	Value bool
+}
+
+// NewBoolExpr returns a new BoolExpr.
+func NewBoolExpr(t *lexer.Token) *BoolExpr {
+	return &BoolExpr{
+		Token: t,
+		Value: t.Type == lexer.TRUE,
+	}
+}
+
+func (expr *BoolExpr) expression()          {}
+func (expr *BoolExpr) TokenLiteral() string { return expr.Token.String }
+func (expr *BoolExpr) Pos() lexer.Pos       { return expr.Token.Pos() }
+func (expr *BoolExpr) End() lexer.Pos       { return expr.Token.End() }
+func (expr *BoolExpr) String() string       { return expr.Token.String }
+
+// PrefixExpr is a unary operator expression, e.g., "-x" or "!ok".
+type PrefixExpr struct {
+	Token    *lexer.Token
+	Operator string
+	Right    Expression
+}
+
+// NewPrefixExpr returns a new PrefixExpr.
+func NewPrefixExpr(t *lexer.Token, right Expression) *PrefixExpr {
+	return &PrefixExpr{
+		Token:    t,
+		Operator: t.String,
+		Right:    right,
+	}
+}
+
+func (expr *PrefixExpr) expression()          {}
+func (expr *PrefixExpr) TokenLiteral() string { return expr.Token.String }
+func (expr *PrefixExpr) Pos() lexer.Pos       { return expr.Token.Pos() }
+func (expr *PrefixExpr) End() lexer.Pos       { return expr.Right.End() }
+
+func (expr *PrefixExpr) String() string {
+	return "(" + expr.Operator + expr.Right.String() + ")"
+}
+
+// InfixExpr is a binary operator expression, e.g., "a + b".
+type InfixExpr struct {
+	Token    *lexer.Token
+	Left     Expression
+	Operator string
+	Right    Expression
+}
+
+// NewInfixExpr returns a new InfixExpr.
+func NewInfixExpr(t *lexer.Token, left, right Expression) *InfixExpr {
+	return &InfixExpr{
+		Token:    t,
+		Left:     left,
+		Operator: t.String,
+		Right:    right,
+	}
+}
+
+func (expr *InfixExpr) expression()          {}
+func (expr *InfixExpr) TokenLiteral() string { return expr.Token.String }
+func (expr *InfixExpr) Pos() lexer.Pos       { return expr.Left.Pos() }
+func (expr *InfixExpr) End() lexer.Pos       { return expr.Right.End() }
+
+func (expr *InfixExpr) String() string {
+	return "(" + expr.Left.String() + " " + expr.Operator + " " + expr.Right.String() + ")"
+}
+
+// ParenExpr is a parenthesized expression, e.g., "(a + b)". It only exists
+// so that the parentheses are part of the expression's span; it evaluates
+// to its inner expression.
+type ParenExpr struct {
+	Lparen *lexer.Token
+	Expr   Expression
+	Rparen *lexer.Token
+}
+
+// NewParenExpr returns a new ParenExpr.
+func NewParenExpr(lparen *lexer.Token, expr Expression, rparen *lexer.Token) *ParenExpr {
+	return &ParenExpr{
+		Lparen: lparen,
+		Expr:   expr,
+		Rparen: rparen,
+	}
+}
+
+func (expr *ParenExpr) expression()          {}
+func (expr *ParenExpr) TokenLiteral() string { return expr.Lparen.String }
+func (expr *ParenExpr) Pos() lexer.Pos       { return expr.Lparen.Pos() }
+func (expr *ParenExpr) End() lexer.Pos       { return expr.Rparen.End() }
+
+// String returns the inner expression's string, which already shows how
+// the expression is grouped.
+func (expr *ParenExpr) String() string { return expr.Expr.String() }
+
+// FunctionLiteral is a function literal expression, e.g.,
+// "fn(a, b) { a + b }". Its Token is the "fn" keyword so the function's
+// definition site is always known.
+type FunctionLiteral struct {
+	Token      *lexer.Token
+	Parameters []*IdentExpr
+	Body       *BlockStatement
+}
+
+// NewFunctionLiteral returns a new FunctionLiteral.
+func NewFunctionLiteral(t *lexer.Token, params []*IdentExpr, body *BlockStatement) *FunctionLiteral {
+	return &FunctionLiteral{
+		Token:      t,
+		Parameters: params,
+		Body:       body,
+	}
+}
+
+func (expr *FunctionLiteral) expression()          {}
+func (expr *FunctionLiteral) TokenLiteral() string { return expr.Token.String }
+func (expr *FunctionLiteral) Pos() lexer.Pos       { return expr.Token.Pos() }
+func (expr *FunctionLiteral) End() lexer.Pos       { return expr.Body.End() }
+
+func (expr *FunctionLiteral) String() string {
+	params := make([]string, len(expr.Parameters))
+	for i, param := range expr.Parameters {
+		params[i] = param.String()
+	}
+	return expr.TokenLiteral() + "(" + strings.Join(params, ", ") + ") " + expr.Body.String()
+}
+
+// IfExpression is a conditional expression, e.g.,
+// "if (x > y) { x } else { y }". Alternative is nil when there is no else
+// branch. An "else if" chain is represented as an Alternative block holding
+// a single IfExpression statement.
+type IfExpression struct {
+	Token       *lexer.Token
+	Condition   Expression
+	Consequence *BlockStatement
+	Alternative *BlockStatement
+}
+
+// NewIfExpression returns a new IfExpression.
+func NewIfExpression(t *lexer.Token, cond Expression, consequence, alternative *BlockStatement) *IfExpression {
+	return &IfExpression{
+		Token:       t,
+		Condition:   cond,
+		Consequence: consequence,
+		Alternative: alternative,
+	}
+}
+
+func (expr *IfExpression) expression()          {}
+func (expr *IfExpression) TokenLiteral() string { return expr.Token.String }
+func (expr *IfExpression) Pos() lexer.Pos       { return expr.Token.Pos() }
+
+func (expr *IfExpression) End() lexer.Pos {
+	if expr.Alternative != nil {
+		return expr.Alternative.End()
+	}
+	return expr.Consequence.End()
+}
+
+func (expr *IfExpression) String() string {
+	s := expr.TokenLiteral() + " " + expr.Condition.String() + " " + expr.Consequence.String()
+	if expr.Alternative != nil {
+		s += " else " + expr.Alternative.String()
+	}
+	return s
+}
+
+// CallExpression is a function call expression, e.g., "add(1, 2)". Its
+// Token is the opening parenthesis.
+type CallExpression struct {
+	Token     *lexer.Token
+	Function  Expression
+	Arguments []Expression
+	Rparen    *lexer.Token
+}
+
+// NewCallExpression returns a new CallExpression.
+func NewCallExpression(t *lexer.Token, fn Expression, args []Expression, rparen *lexer.Token) *CallExpression {
+	return &CallExpression{
+		Token:     t,
+		Function:  fn,
+		Arguments: args,
+		Rparen:    rparen,
+	}
+}
+
+func (expr *CallExpression) expression()          {}
+func (expr *CallExpression) TokenLiteral() string { return expr.Token.String }
+func (expr *CallExpression) Pos() lexer.Pos       { return expr.Function.Pos() }
+func (expr *CallExpression) End() lexer.Pos       { return expr.Rparen.End() }
+
+func (expr *CallExpression) String() string {
+	return expr.Function.String() + "(" + joinExprs(expr.Arguments) + ")"
+}
+
+// ArrayLiteral is an array literal expression, e.g., "[1, 2 * 3]".
+type ArrayLiteral struct {
+	Token    *lexer.Token
+	Elements []Expression
+	Rsquare  *lexer.Token
+}
+
+// NewArrayLiteral returns a new ArrayLiteral.
+func NewArrayLiteral(t *lexer.Token, elems []Expression, rsquare *lexer.Token) *ArrayLiteral {
+	return &ArrayLiteral{
+		Token:    t,
+		Elements: elems,
+		Rsquare:  rsquare,
+	}
+}
+
+func (expr *ArrayLiteral) expression()          {}
+func (expr *ArrayLiteral) TokenLiteral() string { return expr.Token.String }
+func (expr *ArrayLiteral) Pos() lexer.Pos       { return expr.Token.Pos() }
+func (expr *ArrayLiteral) End() lexer.Pos       { return expr.Rsquare.End() }
+func (expr *ArrayLiteral) String() string       { return "[" + joinExprs(expr.Elements) + "]" }
+
+// IndexExpression is an index expression, e.g., "arr[i]". Its Token is the
+// opening square bracket.
+type IndexExpression struct {
+	Token   *lexer.Token
+	Left    Expression
+	Index   Expression
+	Rsquare *lexer.Token
+}
+
+// NewIndexExpression returns a new IndexExpression.
+func NewIndexExpression(t *lexer.Token, left, index Expression, rsquare *lexer.Token) *IndexExpression {
+	return &IndexExpression{
+		Token:   t,
+		Left:    left,
+		Index:   index,
+		Rsquare: rsquare,
+	}
+}
+
+func (expr *IndexExpression) expression()          {}
+func (expr *IndexExpression) TokenLiteral() string { return expr.Token.String }
+func (expr *IndexExpression) Pos() lexer.Pos       { return expr.Left.Pos() }
+func (expr *IndexExpression) End() lexer.Pos       { return expr.Rsquare.End() }
+
+func (expr *IndexExpression) String() string {
+	return "(" + expr.Left.String() + "[" + expr.Index.String() + "])"
+}
+
+// HashPair is a single key/value pair in a HashLiteral.
+type HashPair struct {
+	Key   Expression
+	Value Expression
+}
+
+// HashLiteral is a hash literal expression, e.g., `{"a": 1, "b": 2}`. Pairs
+// are kept in source order.
+type HashLiteral struct {
+	Token  *lexer.Token
+	Pairs  []HashPair
+	Rbrace *lexer.Token
+}
+
+// NewHashLiteral returns a new HashLiteral.
+func NewHashLiteral(t *lexer.Token, pairs []HashPair, rbrace *lexer.Token) *HashLiteral {
+	return &HashLiteral{
+		Token:  t,
+		Pairs:  pairs,
+		Rbrace: rbrace,
+	}
+}
+
+func (expr *HashLiteral) expression()          {}
+func (expr *HashLiteral) TokenLiteral() string { return expr.Token.String }
+func (expr *HashLiteral) Pos() lexer.Pos       { return expr.Token.Pos() }
+func (expr *HashLiteral) End() lexer.Pos       { return expr.Rbrace.End() }
+
+func (expr *HashLiteral) String() string {
+	pairs := make([]string, len(expr.Pairs))
+	for i, pair := range expr.Pairs {
+		pairs[i] = pair.Key.String() + ": " + pair.Value.String()
+	}
+	return "{" + strings.Join(pairs, ", ") + "}"
+}
+
+// joinExprs returns a comma separated list of expressions.
+func joinExprs(exprs []Expression) string {
+	strs := make([]string, len(exprs))
+	for i, expr := range exprs {
+		strs[i] = expr.String()
+	}
+	return strings.Join(strs, ", ")
+}
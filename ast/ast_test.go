@@ -1 +1,58 @@
 package ast_test
+
+import (
+	"testing"
+
+	"github.com/dgnorton/monkey/ast"
+	"github.com/dgnorton/monkey/parser"
+)
+
+func TestNode_Span(t *testing.T) {
+	tests := []struct {
+		code string
+		node func(prog *ast.Program) ast.Node
+		exp  string
+	}{
+		{"  x  ", firstExpr, "x"},
+		{"-a * b;", firstExpr, "-a * b"},
+		{"-a * b;", firstStmt, "-a * b;"},
+		{"(a + b) * c", firstExpr, "(a + b) * c"},
+		{"-(a)", firstExpr, "-(a)"},
+		{"((a))[0]", firstExpr, "((a))[0]"},
+		{"let x = 1 +\n  2 ;", firstStmt, "let x = 1 +\n  2 ;"},
+		{"let x = 1 + 2\n", firstStmt, "let x = 1 + 2"},
+		{`"丢" + "b"`, firstExpr, `"丢" + "b"`},
+		{"add(1, [2, 3])[0]", firstExpr, "add(1, [2, 3])[0]"},
+		{"{1: 2}", firstExpr, "{1: 2}"},
+		{"`a ${b} c` + d", func(prog *ast.Program) ast.Node {
+			return firstExpr(prog).(*ast.InfixExpr).Left
+		}, "`a ${b} c`"},
+		{"fn(a) { return a; } (1)", firstExpr, "fn(a) { return a; } (1)"},
+		{"if (x) { 1 } else if (y) { 2 }", firstExpr, "if (x) { 1 } else if (y) { 2 }"},
+		{"if (x) { 1 }", func(prog *ast.Program) ast.Node {
+			return firstExpr(prog).(*ast.IfExpression).Consequence
+		}, "{ 1 }"},
+		{"a; b; c", func(prog *ast.Program) ast.Node { return prog }, "a; b; c"},
+	}
+
+	for _, test := range tests {
+		prog, err := parser.Parse(test.code)
+		if err != nil {
+			t.Fatalf("%s: %s", test.code, err)
+		}
+
+		node := test.node(prog)
+		pos, end := node.Pos(), node.End()
+		if got := test.code[pos.Offset:end.Offset]; got != test.exp {
+			t.Fatalf("%q: exp span %q, got %q (%s-%s)", test.code, test.exp, got, pos, end)
+		}
+	}
+}
+
+func firstStmt(prog *ast.Program) ast.Node {
+	return prog.Statements[0]
+}
+
+func firstExpr(prog *ast.Program) ast.Node {
+	return prog.Statements[0].(*ast.ExpressionStmt).Expression
+}
@@ -0,0 +1,604 @@
+package eval
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+	"strings"
+
+	"github.com/dgnorton/monkey/ast"
+	"github.com/dgnorton/monkey/lexer"
+	"github.com/dgnorton/monkey/object"
+)
+
+// Singleton values. There is only ever one null, true and false object so
+// they can be compared by pointer.
+var (
+	NULL  = &object.Null{}
+	TRUE  = &object.Boolean{Value: true}
+	FALSE = &object.Boolean{Value: false}
+)
+
+// Eval evaluates an AST node in the given environment and returns the
+// resulting value. Runtime errors are returned as *object.Error values.
+// Statements that don't produce a value return nil.
+func Eval(node ast.Node, env *object.Environment) object.Object {
+	switch node := node.(type) {
+	case *ast.Program:
+		return evalProgram(node, env)
+	case *ast.LetStmt:
+		val := Eval(node.Value, env)
+		if isError(val) {
+			return val
+		}
+		env.Set(node.Name.Value, val)
+		return nil
+	case *ast.ReturnStmt:
+		if node.Value == nil {
+			return &object.ReturnValue{Value: NULL}
+		}
+		val := Eval(node.Value, env)
+		if isError(val) {
+			return val
+		}
+		return &object.ReturnValue{Value: val}
+	case *ast.ExpressionStmt:
+		return Eval(node.Expression, env)
+	case *ast.BlockStatement:
+		return evalBlockStmt(node, env)
+	case *ast.IdentExpr:
+		return evalIdent(node, env)
+	case *ast.IntExpr:
+		if node.Big != nil {
+			return object.NewInteger(node.Big)
+		}
+		return &object.Integer{Value: int64(node.Value)}
+	case *ast.FloatLiteral:
+		return &object.Float{Value: node.Value}
+	case *ast.StringLiteral:
+		return &object.String{Value: node.Value}
+	case *ast.TemplateLiteral:
+		return evalTemplateLiteral(node, env)
+	case *ast.BoolExpr:
+		return nativeBool(node.Value)
+	case *ast.ParenExpr:
+		return Eval(node.Expr, env)
+	case *ast.PrefixExpr:
+		right := Eval(node.Right, env)
+		if isError(right) {
+			return right
+		}
+		return evalPrefixExpr(node.Token, right)
+	case *ast.InfixExpr:
+		if node.Token.Type == lexer.AND || node.Token.Type == lexer.OR {
+			return evalLogicalExpr(node, env)
+		}
+		left := Eval(node.Left, env)
+		if isError(left) {
+			return left
+		}
+		right := Eval(node.Right, env)
+		if isError(right) {
+			return right
+		}
+		return evalInfixExpr(node.Token, left, right)
+	case *ast.ArrayLiteral:
+		elems, err := evalExprs(node.Elements, env)
+		if err != nil {
+			return err
+		}
+		return &object.Array{Elements: elems}
+	case *ast.HashLiteral:
+		return evalHashLiteral(node, env)
+	case *ast.IndexExpression:
+		left := Eval(node.Left, env)
+		if isError(left) {
+			return left
+		}
+		index := Eval(node.Index, env)
+		if isError(index) {
+			return index
+		}
+		return evalIndexExpr(node.Token, left, index)
+	case *ast.IfExpression:
+		return evalIfExpr(node, env)
+	case *ast.FunctionLiteral:
+		return &object.Function{Literal: node, Env: env}
+	case *ast.CallExpression:
+		fn := Eval(node.Function, env)
+		if isError(fn) {
+			return fn
+		}
+		args, err := evalExprs(node.Arguments, env)
+		if err != nil {
+			return err
+		}
+		return applyFunction(node.Token, fn, args)
+	default:
+		return newError(nil, "unsupported node: %T", node)
+	}
+}
+
+// evalProgram evaluates each statement in the program and returns the value
+// of the last one. Evaluation stops early on a return value or error.
+func evalProgram(prog *ast.Program, env *object.Environment) object.Object {
+	var result object.Object
+	for _, stmt := range prog.Statements {
+		result = Eval(stmt, env)
+
+		switch result := result.(type) {
+		case *object.ReturnValue:
+			return result.Value
+		case *object.Error:
+			return result
+		}
+	}
+	return result
+}
+
+// evalBlockStmt evaluates each statement in the block and returns the value
+// of the last one. Unlike evalProgram, return values are passed up still
+// wrapped so they unwind through every enclosing block.
+func evalBlockStmt(block *ast.BlockStatement, env *object.Environment) object.Object {
+	var result object.Object
+	for _, stmt := range block.Statements {
+		result = Eval(stmt, env)
+
+		if result != nil && (result.Type() == object.RETURN || result.Type() == object.ERROR) {
+			return result
+		}
+	}
+	return result
+}
+
+// evalIfExpr evaluates the branch selected by the condition. An if
+// expression without a taken branch, or whose branch has no value,
+// evaluates to null.
+func evalIfExpr(expr *ast.IfExpression, env *object.Environment) object.Object {
+	cond := Eval(expr.Condition, env)
+	if isError(cond) {
+		return cond
+	}
+
+	block := expr.Alternative
+	if isTruthy(cond) {
+		block = expr.Consequence
+	}
+
+	if block == nil {
+		return NULL
+	}
+
+	if result := Eval(block, env); result != nil {
+		return result
+	}
+	return NULL
+}
+
+// evalTemplateLiteral evaluates each part of a template literal in source
+// order and joins their string representations. Strings are included
+// without quotes.
+func evalTemplateLiteral(expr *ast.TemplateLiteral, env *object.Environment) object.Object {
+	var sb strings.Builder
+	for _, part := range expr.Parts {
+		val := Eval(part, env)
+		if isError(val) {
+			return val
+		}
+		sb.WriteString(val.Inspect())
+	}
+	return &object.String{Value: sb.String()}
+}
+
+// evalHashLiteral evaluates each key and value of a hash literal in source
+// order. Later duplicate keys overwrite earlier ones.
+func evalHashLiteral(expr *ast.HashLiteral, env *object.Environment) object.Object {
+	hash := object.NewHash()
+	for _, pair := range expr.Pairs {
+		key := Eval(pair.Key, env)
+		if isError(key) {
+			return key
+		}
+
+		hashable, ok := key.(object.Hashable)
+		if !ok {
+			return newError(expr.Token, "unusable as hash key: %s", key.Type())
+		}
+
+		val := Eval(pair.Value, env)
+		if isError(val) {
+			return val
+		}
+
+		hash.Set(hashable, val)
+	}
+	return hash
+}
+
+func evalIndexExpr(tok *lexer.Token, left, index object.Object) object.Object {
+	switch left := left.(type) {
+	case *object.Array:
+		return evalArrayIndexExpr(tok, left, index)
+	case *object.Hash:
+		return evalHashIndexExpr(tok, left, index)
+	}
+	return newError(tok, "index operator not supported: %s", left.Type())
+}
+
+// evalArrayIndexExpr evaluates arr[index]. Indexing outside the bounds of an
+// array is a runtime error rather than null so that off-by-one mistakes are
+// reported where they happen instead of surfacing later as a stray null.
+func evalArrayIndexExpr(tok *lexer.Token, arr *object.Array, index object.Object) object.Object {
+	if index.Type() != object.INTEGER {
+		return newError(tok, "array index must be INTEGER, got %s", index.Type())
+	}
+
+	i, ok := index.(*object.Integer)
+	if !ok || i.Value < 0 || i.Value >= int64(len(arr.Elements)) {
+		return newError(tok, "index out of range: %s (len %d)", index.Inspect(), len(arr.Elements))
+	}
+
+	return arr.Elements[i.Value]
+}
+
+// evalHashIndexExpr evaluates hash[key]. Missing keys evaluate to null.
+func evalHashIndexExpr(tok *lexer.Token, hash *object.Hash, key object.Object) object.Object {
+	hashable, ok := key.(object.Hashable)
+	if !ok {
+		return newError(tok, "unusable as hash key: %s", key.Type())
+	}
+
+	val, ok := hash.Get(hashable)
+	if !ok {
+		return NULL
+	}
+	return val
+}
+
+// evalExprs evaluates a list of expressions from left to right. The first
+// error encountered stops evaluation and is returned.
+func evalExprs(exprs []ast.Expression, env *object.Environment) ([]object.Object, *object.Error) {
+	objs := make([]object.Object, 0, len(exprs))
+	for _, expr := range exprs {
+		obj := Eval(expr, env)
+		if err, ok := obj.(*object.Error); ok {
+			return nil, err
+		}
+		objs = append(objs, obj)
+	}
+	return objs, nil
+}
+
+// applyFunction calls fn with args. tok is the call's opening parenthesis
+// and is used to locate errors.
+func applyFunction(tok *lexer.Token, fn object.Object, args []object.Object) object.Object {
+	f, ok := fn.(*object.Function)
+	if !ok {
+		return newError(tok, "not a function: %s", fn.Type())
+	}
+
+	params := f.Literal.Parameters
+	if len(params) != len(args) {
+		return newError(tok, "wrong number of arguments: want %d, got %d (fn defined at %s)", len(params), len(args), f.Defined())
+	}
+
+	env := object.NewEnclosedEnvironment(f.Env)
+	for i, param := range params {
+		env.Set(param.Value, args[i])
+	}
+
+	result := Eval(f.Literal.Body, env)
+	if ret, ok := result.(*object.ReturnValue); ok {
+		return ret.Value
+	}
+	if result == nil {
+		return NULL
+	}
+	return result
+}
+
+func evalIdent(ident *ast.IdentExpr, env *object.Environment) object.Object {
+	val, ok := env.Get(ident.Value)
+	if !ok {
+		return newError(ident.Token, "identifier not found: %s", ident.Value)
+	}
+	return val
+}
+
+func evalPrefixExpr(tok *lexer.Token, right object.Object) object.Object {
+	switch tok.Type {
+	case lexer.NOT:
+		return nativeBool(!isTruthy(right))
+	case lexer.SUB:
+		switch right := right.(type) {
+		case *object.Integer:
+			if right.Value == math.MinInt64 {
+				return object.NewInteger(new(big.Int).Neg(big.NewInt(right.Value)))
+			}
+			return &object.Integer{Value: -right.Value}
+		case *object.BigInteger:
+			return object.NewInteger(new(big.Int).Neg(right.Value))
+		case *object.Float:
+			return &object.Float{Value: -right.Value}
+		}
+	}
+	return newError(tok, "unknown operator: %s%s", tok.String, right.Type())
+}
+
+// evalLogicalExpr evaluates && and ||. The right operand is only evaluated
+// if the left one doesn't already decide the result. Both operators evaluate
+// to a boolean.
+func evalLogicalExpr(expr *ast.InfixExpr, env *object.Environment) object.Object {
+	left := Eval(expr.Left, env)
+	if isError(left) {
+		return left
+	}
+
+	if isTruthy(left) == (expr.Token.Type == lexer.OR) {
+		return nativeBool(isTruthy(left))
+	}
+
+	right := Eval(expr.Right, env)
+	if isError(right) {
+		return right
+	}
+	return nativeBool(isTruthy(right))
+}
+
+func evalInfixExpr(tok *lexer.Token, left, right object.Object) object.Object {
+	switch {
+	case left.Type() == object.INTEGER && right.Type() == object.INTEGER:
+		l, lok := left.(*object.Integer)
+		r, rok := right.(*object.Integer)
+		if lok && rok {
+			return evalIntInfixExpr(tok, l, r)
+		}
+		return evalBigIntInfixExpr(tok, toBigInt(left), toBigInt(right))
+	case isNumber(left) && isNumber(right):
+		return evalFloatInfixExpr(tok, left, right)
+	case left.Type() == object.STRING && right.Type() == object.STRING:
+		return evalStringInfixExpr(tok, left.(*object.String), right.(*object.String))
+	case left.Type() != right.Type():
+		return newError(tok, "type mismatch: %s %s %s", left.Type(), tok.String, right.Type())
+	case tok.Type == lexer.EQ:
+		return nativeBool(left == right)
+	case tok.Type == lexer.NEQ:
+		return nativeBool(left != right)
+	}
+	return newError(tok, "unknown operator: %s %s %s", left.Type(), tok.String, right.Type())
+}
+
+// evalIntInfixExpr evaluates an infix expression on two int64 integers.
+// Arithmetic that would overflow is redone with big integers instead.
+func evalIntInfixExpr(tok *lexer.Token, left, right *object.Integer) object.Object {
+	l, r := left.Value, right.Value
+	switch tok.Type {
+	case lexer.ADD:
+		if sum := l + r; (sum > l) == (r > 0) {
+			return &object.Integer{Value: sum}
+		}
+	case lexer.SUB:
+		if diff := l - r; (diff < l) == (r > 0) {
+			return &object.Integer{Value: diff}
+		}
+	case lexer.MUL:
+		if prod := l * r; l == 0 || prod/l == r && !(l == -1 && r == math.MinInt64) {
+			return &object.Integer{Value: prod}
+		}
+	case lexer.DIV:
+		if r == 0 {
+			return newError(tok, "division by zero")
+		}
+		if !(l == math.MinInt64 && r == -1) {
+			return &object.Integer{Value: l / r}
+		}
+	case lexer.MOD:
+		if r == 0 {
+			return newError(tok, "division by zero")
+		}
+		return &object.Integer{Value: l % r}
+	case lexer.BITAND:
+		return &object.Integer{Value: l & r}
+	case lexer.BITOR:
+		return &object.Integer{Value: l | r}
+	case lexer.XOR:
+		return &object.Integer{Value: l ^ r}
+	case lexer.SHL:
+		if r >= 0 && r < 63 && (l<<uint(r))>>uint(r) == l {
+			return &object.Integer{Value: l << uint(r)}
+		}
+	case lexer.SHR:
+		if r >= 0 {
+			return &object.Integer{Value: l >> uint64(r)}
+		}
+		return newError(tok, "negative shift count: %d", r)
+	case lexer.LT:
+		return nativeBool(l < r)
+	case lexer.GT:
+		return nativeBool(l > r)
+	case lexer.LTE:
+		return nativeBool(l <= r)
+	case lexer.GTE:
+		return nativeBool(l >= r)
+	case lexer.EQ:
+		return nativeBool(l == r)
+	case lexer.NEQ:
+		return nativeBool(l != r)
+	default:
+		return newError(tok, "unknown operator: %s %s %s", left.Type(), tok.String, right.Type())
+	}
+	return evalBigIntInfixExpr(tok, big.NewInt(l), big.NewInt(r))
+}
+
+// evalBigIntInfixExpr evaluates an infix expression on two big integers.
+// Results that fit in an int64 are returned as regular integers.
+func evalBigIntInfixExpr(tok *lexer.Token, l, r *big.Int) object.Object {
+	switch tok.Type {
+	case lexer.ADD:
+		return object.NewInteger(new(big.Int).Add(l, r))
+	case lexer.SUB:
+		return object.NewInteger(new(big.Int).Sub(l, r))
+	case lexer.MUL:
+		return object.NewInteger(new(big.Int).Mul(l, r))
+	case lexer.DIV:
+		if r.Sign() == 0 {
+			return newError(tok, "division by zero")
+		}
+		return object.NewInteger(new(big.Int).Quo(l, r))
+	case lexer.MOD:
+		if r.Sign() == 0 {
+			return newError(tok, "division by zero")
+		}
+		return object.NewInteger(new(big.Int).Rem(l, r))
+	case lexer.BITAND:
+		return object.NewInteger(new(big.Int).And(l, r))
+	case lexer.BITOR:
+		return object.NewInteger(new(big.Int).Or(l, r))
+	case lexer.XOR:
+		return object.NewInteger(new(big.Int).Xor(l, r))
+	case lexer.SHL, lexer.SHR:
+		return evalBigIntShift(tok, l, r)
+	case lexer.LT:
+		return nativeBool(l.Cmp(r) < 0)
+	case lexer.GT:
+		return nativeBool(l.Cmp(r) > 0)
+	case lexer.LTE:
+		return nativeBool(l.Cmp(r) <= 0)
+	case lexer.GTE:
+		return nativeBool(l.Cmp(r) >= 0)
+	case lexer.EQ:
+		return nativeBool(l.Cmp(r) == 0)
+	case lexer.NEQ:
+		return nativeBool(l.Cmp(r) != 0)
+	}
+	return newError(tok, "unknown operator: %s %s %s", object.INTEGER, tok.String, object.INTEGER)
+}
+
+// evalBigIntShift evaluates l << r or l >> r. Left shifts are limited so
+// that the result has no more than lexer.MaxIntBits bits; right shifts are
+// arithmetic, like they are for int64 integers.
+func evalBigIntShift(tok *lexer.Token, l, r *big.Int) object.Object {
+	if r.Sign() < 0 {
+		return newError(tok, "negative shift count: %s", r)
+	}
+
+	if tok.Type == lexer.SHR {
+		if !r.IsUint64() || r.Uint64() > uint64(l.BitLen()) {
+			r = big.NewInt(int64(l.BitLen()))
+		}
+		return object.NewInteger(new(big.Int).Rsh(l, uint(r.Uint64())))
+	}
+
+	if l.Sign() == 0 {
+		return &object.Integer{Value: 0}
+	}
+	if !r.IsInt64() || int64(l.BitLen())+r.Int64() > lexer.MaxIntBits {
+		return newError(tok, "shift count too large: %s", r)
+	}
+	return object.NewInteger(new(big.Int).Lsh(l, uint(r.Int64())))
+}
+
+// evalFloatInfixExpr evaluates an infix expression with at least one float
+// operand. Integer operands are converted to floats first. Division by zero
+// follows IEEE 754 and produces an infinity or NaN.
+func evalFloatInfixExpr(tok *lexer.Token, left, right object.Object) object.Object {
+	l, r := toFloat(left), toFloat(right)
+	switch tok.Type {
+	case lexer.ADD:
+		return &object.Float{Value: l + r}
+	case lexer.SUB:
+		return &object.Float{Value: l - r}
+	case lexer.MUL:
+		return &object.Float{Value: l * r}
+	case lexer.DIV:
+		return &object.Float{Value: l / r}
+	case lexer.MOD:
+		return &object.Float{Value: math.Mod(l, r)}
+	case lexer.LT:
+		return nativeBool(l < r)
+	case lexer.GT:
+		return nativeBool(l > r)
+	case lexer.LTE:
+		return nativeBool(l <= r)
+	case lexer.GTE:
+		return nativeBool(l >= r)
+	case lexer.EQ:
+		return nativeBool(l == r)
+	case lexer.NEQ:
+		return nativeBool(l != r)
+	}
+	return newError(tok, "unknown operator: %s %s %s", left.Type(), tok.String, right.Type())
+}
+
+func evalStringInfixExpr(tok *lexer.Token, left, right *object.String) object.Object {
+	l, r := left.Value, right.Value
+	switch tok.Type {
+	case lexer.ADD:
+		return &object.String{Value: l + r}
+	case lexer.EQ:
+		return nativeBool(l == r)
+	case lexer.NEQ:
+		return nativeBool(l != r)
+	}
+	return newError(tok, "unknown operator: %s %s %s", left.Type(), tok.String, right.Type())
+}
+
+// isNumber returns true if the object is an integer or a float.
+func isNumber(obj object.Object) bool {
+	return obj.Type() == object.INTEGER || obj.Type() == object.FLOAT
+}
+
+// toFloat converts a number object to a float64.
+func toFloat(obj object.Object) float64 {
+	switch obj := obj.(type) {
+	case *object.Integer:
+		return float64(obj.Value)
+	case *object.BigInteger:
+		f, _ := new(big.Float).SetInt(obj.Value).Float64()
+		return f
+	case *object.Float:
+		return obj.Value
+	}
+	return 0
+}
+
+// toBigInt converts an integer object to a big.Int.
+func toBigInt(obj object.Object) *big.Int {
+	if obj, ok := obj.(*object.BigInteger); ok {
+		return obj.Value
+	}
+	return big.NewInt(obj.(*object.Integer).Value)
+}
+
+// nativeBool returns the singleton boolean object for b.
+func nativeBool(b bool) *object.Boolean {
+	if b {
+		return TRUE
+	}
+	return FALSE
+}
+
+// isTruthy returns false for null and false and true for everything else.
+func isTruthy(obj object.Object) bool {
+	switch obj {
+	case NULL, FALSE:
+		return false
+	default:
+		return true
+	}
+}
+
+// isError returns true if the object is a runtime error.
+func isError(obj object.Object) bool {
+	return obj != nil && obj.Type() == object.ERROR
+}
+
+// newError returns a runtime error located at tok. tok may be nil if the
+// error has no meaningful source position.
+func newError(tok *lexer.Token, format string, a ...interface{}) *object.Error {
+	err := &object.Error{Message: fmt.Sprintf(format, a...)}
+	if tok != nil {
+		err.File, err.Line, err.Col = tok.File, tok.Line, tok.Col
+	}
+	return err
+}
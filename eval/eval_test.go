@@ -0,0 +1,165 @@
+package eval_test
+
+import (
+	"testing"
+
+	"github.com/dgnorton/monkey/eval"
+	"github.com/dgnorton/monkey/object"
+	"github.com/dgnorton/monkey/parser"
+)
+
+func TestEval(t *testing.T) {
+	tests := []struct {
+		code string
+		exp  string
+	}{
+		{"5", "5"},
+		{"-5", "-5"},
+		{"true", "true"},
+		{"!true", "false"},
+		{"!!5", "true"},
+		{"1 + 2 * 3 - 4 / 2", "5"},
+		{"(1 + 2) * 3", "9"},
+		{"1 < 2 == true", "true"},
+		{"1 > 2 != false", "false"},
+		{"true == true", "true"},
+		{"true != false", "true"},
+		{`"foo" + "bar"`, "foobar"},
+		{`"foo" == "foo"`, "true"},
+		{"let x = 42; x", "42"},
+		{"let x = 2; let y = x * x; y + x", "6"},
+		{"let add = fn(a, b) { a + b }; add(1, 2)", "3"},
+		{"fn(x) { x * 2; }(21)", "42"},
+		{"fn() { }()", "null"},
+		{"let f = fn(x) { let y = x + 1; y * y }; f(f(1))", "25"},
+		{"let newAdder = fn(x) { fn(y) { x + y } }; let addTwo = newAdder(2); addTwo(3)", "5"},
+		{"let x = 10; let f = fn(x) { x }; f(1) + x", "11"},
+		{"fn(a) { a }", "fn(a) { a; }"},
+		{"if (true) { 10 }", "10"},
+		{"if (false) { 10 }", "null"},
+		{"if (1 < 2) { 10 } else { 20 }", "10"},
+		{"if (1 > 2) { 10 } else { 20 }", "20"},
+		{"let x = 2; if (x == 1) { 10 } else if (x == 2) { 20 } else { 30 }", "20"},
+		{"if (true) { }", "null"},
+		{"return 10; 9", "10"},
+		{"9; return 2 * 5; 9", "10"},
+		{"if (true) { if (true) { return 10; } return 1; }", "10"},
+		{"let f = fn(x) { if (x > 0) { return x; } 0 - x }; f(-3) + f(4)", "7"},
+		{"let f = fn() { return; 1 }; f()", "null"},
+		{"let f = fn(x) {\n  x * 2\n  x + 1\n}\nf(3)", "4"},
+		{"let f = fn() { let x = 1; }; f()", "null"},
+		{"[1, 2 * 2, 3 + 3]", "[1, 4, 6]"},
+		{"[]", "[]"},
+		{"[1, 2, 3][0]", "1"},
+		{"let a = [1, 2, 3]; a[1 + 1]", "3"},
+		{"let a = [1, 2, 3]; a[0] + a[1] + a[2]", "6"},
+		{"let f = fn(x) { x * 2 }; [f, f][1](2)", "4"},
+		{"[[1, 2], [3]][0][1]", "2"},
+		{"{}", "{}"},
+		{`let k = "b"; {"a": 1, k: 2, 3: true, true: [4]}`, `{"a": 1, "b": 2, 3: true, true: [4]}`},
+		{`{"a": 1, "a": 2}`, `{"a": 2}`},
+		{`{"a": 1}["a"]`, "1"},
+		{`{"a": 1}["b"]`, "null"},
+		{`{1: "one"}[1]`, "one"},
+		{`{true: "yes", false: "no"}[1 > 2]`, "no"},
+		{`{"1": "string", 1: "int"}[1]`, "int"},
+		{`let config = {"name": "mky", "args": [1, 2]}; config["args"][1]`, "2"},
+		{"1 <= 1", "true"},
+		{"2 >= 3", "false"},
+		{"1.5 <= 1", "false"},
+		{"18446744073709551616 >= 1", "true"},
+		{"7 % 3", "1"},
+		{"-7 % 3", "-1"},
+		{"7.5 % 2", "1.5"},
+		{"18446744073709551617 % 2", "1"},
+		{"6 & 3", "2"},
+		{"6 | 3", "7"},
+		{"6 ^ 3", "5"},
+		{"-1 & 255", "255"},
+		{"1 << 10", "1024"},
+		{"1 << 64", "18446744073709551616"},
+		{"-1 << 63", "-9223372036854775808"},
+		{"1024 >> 3", "128"},
+		{"-8 >> 100", "-1"},
+		{"18446744073709551616 >> 60", "16"},
+		{"(1 << 64) | 1", "18446744073709551617"},
+		{"`plain`", "plain"},
+		{"let name = \"mky\"; `hi ${name}, ${1 + 2} ${[1, \"a\"]} ${true}`", "hi mky, 3 [1, a] true"},
+		{"let f = fn(x) { `<${x}>` }; `${f(`${f(1)}`)}`", "<<1>>"},
+		{"`${ {\"k\": 1}[\"k\"] }`", "1"},
+		{"`${fn() { }()}`", "null"},
+		{"`a\\`b\\${c}`", "a`b${c}"},
+		{"true && false", "false"},
+		{"1 < 2 && 2 < 3", "true"},
+		{"false || 1", "true"},
+		{"false && x", "false"},
+		{"true || x", "true"},
+		{"let n = 0; let f = fn() { n }; n > 0 && f() > 1", "false"},
+	}
+
+	for _, test := range tests {
+		if got := mustEval(test.code, t).Inspect(); got != test.exp {
+			t.Fatalf("%s:\nexp: %s\ngot: %s", test.code, test.exp, got)
+		}
+	}
+}
+
+func TestEval_Errors(t *testing.T) {
+	tests := []struct {
+		code string
+		exp  string
+	}{
+		{"x", "|1 col 1| identifier not found: x"},
+		{"-true", "|1 col 1| unknown operator: -BOOLEAN"},
+		{"1 + true; 5", "|1 col 3| type mismatch: INTEGER + BOOLEAN"},
+		{"true + false", "|1 col 6| unknown operator: BOOLEAN + BOOLEAN"},
+		{`"a" - "b"`, "|1 col 5| unknown operator: STRING - STRING"},
+		{"let x = 1 / 0; x", "|1 col 11| division by zero"},
+		{"5(1)", "|1 col 2| not a function: INTEGER"},
+		{"let f = fn(a, b) { a };\nf(1)", "|2 col 2| wrong number of arguments: want 2, got 1 (fn defined at |1 col 9|)"},
+		{"fn() { x }()", "|1 col 8| identifier not found: x"},
+		{"if (x) { 1 }", "|1 col 5| identifier not found: x"},
+		{"[1, 2, 3][3]", "|1 col 10| index out of range: 3 (len 3)"},
+		{"[1, 2, 3][-1]", "|1 col 10| index out of range: -1 (len 3)"},
+		{"[1][true]", "|1 col 4| array index must be INTEGER, got BOOLEAN"},
+		{"1[0]", "|1 col 2| index operator not supported: INTEGER"},
+		{"[1, x]", "|1 col 5| identifier not found: x"},
+		{"[1][18446744073709551616]", "|1 col 4| index out of range: 18446744073709551616 (len 1)"},
+		{"18446744073709551616 / 0", "|1 col 22| division by zero"},
+		{"1.5 + true", "|1 col 5| type mismatch: FLOAT + BOOLEAN"},
+		{"{[1]: 2}", "|1 col 1| unusable as hash key: ARRAY"},
+		{"{1: 2}[fn(x) { x }]", "|1 col 7| unusable as hash key: FUNCTION"},
+		{"fn() { return -true; }()", "|1 col 15| unknown operator: -BOOLEAN"},
+		{"1 % 0", "|1 col 3| division by zero"},
+		{"1.5 & 1", "|1 col 5| unknown operator: FLOAT & INTEGER"},
+		{"1 << -1", "|1 col 3| negative shift count: -1"},
+		{"1 >> -1", "|1 col 3| negative shift count: -1"},
+		{"1 << 100000", "|1 col 3| shift count too large: 100000"},
+		{`"a" <= "b"`, "|1 col 5| unknown operator: STRING <= STRING"},
+		{"true && x", "|1 col 9| identifier not found: x"},
+		{"`a ${x}`", "|1 col 6| identifier not found: x"},
+	}
+
+	for _, test := range tests {
+		obj := mustEval(test.code, t)
+		got, ok := obj.(*object.Error)
+		if !ok {
+			t.Fatalf("%s: expected error, got %T", test.code, obj)
+		}
+
+		if got.Inspect() != test.exp {
+			t.Fatalf("%s:\nexp: %s\ngot: %s", test.code, test.exp, got.Inspect())
+		}
+	}
+}
+
+func mustEval(code string, t *testing.T) object.Object {
+	t.Helper()
+
+	prog, err := parser.Parse(code)
+	if err != nil {
+		t.Fatalf("%s: %s", code, err)
+	}
+
+	return eval.Eval(prog, object.NewEnvironment())
+}
@@ -0,0 +1,82 @@
+package lexer
+
+// Config defines the language dialect accepted by a lexer. Embedders can
+// use it to restrict the language, e.g., to expressions only, or to rename
+// keywords without changing the parser.
+//
+// A Config must not be modified while a lexer is using it.
+type Config struct {
+	// Keywords maps reserved words to their token types. Identifiers that
+	// aren't keywords are IDENT tokens. A keyword may map to any token type
+	// the parser understands, e.g., "and" to AND.
+	Keywords map[string]TokenType
+
+	// Operators is the set of operator token types, ASSIGN through SHR,
+	// that are allowed. Other operators are invalid tokens. Operators are
+	// recognized before being checked, so if SHL isn't allowed "<<" is an
+	// invalid token rather than two LT tokens.
+	Operators map[TokenType]bool
+
+	// UnicodeIdents allows identifiers to contain non-ASCII letters and
+	// digits. If false, such identifiers are reported as errors.
+	UnicodeIdents bool
+}
+
+// DefaultConfig returns a new Config for the full Monkey language.
+func DefaultConfig() *Config {
+	return &Config{
+		Keywords: map[string]TokenType{
+			"else":   ELSE,
+			"false":  FALSE,
+			"fn":     FN,
+			"if":     IF,
+			"let":    LET,
+			"return": RETURN,
+			"true":   TRUE,
+		},
+		Operators:     allOperators(),
+		UnicodeIdents: true,
+	}
+}
+
+// ExpressionConfig returns a new Config for a dialect of Monkey that only
+// has expressions, suitable for end users writing formulas or filters.
+// Functions, let and return statements, and assignment aren't available;
+// "fn", "let" and "return" are ordinary identifiers.
+func ExpressionConfig() *Config {
+	cfg := DefaultConfig()
+	for _, kw := range []string{"fn", "let", "return"} {
+		delete(cfg.Keywords, kw)
+	}
+	delete(cfg.Operators, ASSIGN)
+	return cfg
+}
+
+// allOperators returns a set containing every operator token type.
+func allOperators() map[TokenType]bool {
+	ops := make(map[TokenType]bool)
+	for t := ASSIGN; t.IsOperator(); t++ {
+		ops[t] = true
+	}
+	return ops
+}
+
+// operatorSet returns c.Operators as a bit set, with bit t-ASSIGN set for
+// each allowed operator t, which is much faster to check than the map.
+func (c *Config) operatorSet() uint64 {
+	var ops uint64
+	for t := ASSIGN; t.IsOperator(); t++ {
+		if c.Operators[t] {
+			ops |= 1 << uint(t-ASSIGN)
+		}
+	}
+	return ops
+}
+
+// IsOperator returns true if the token type is an operator.
+func (t TokenType) IsOperator() bool {
+	return ASSIGN <= t && t <= SHR
+}
+
+// defaultConfig is used by lexers created without a Config.
+var defaultConfig = DefaultConfig()
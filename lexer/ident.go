@@ -0,0 +1,150 @@
+package lexer
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Identifiers follow Unicode Standard Annex #31, "Unicode Identifier and
+// Pattern Syntax". They begin with a letter or '_', which may be followed
+// by letters, decimal digits, combining marks and connector punctuation.
+// Identifiers are normalized to NFC, so identifiers that are canonically
+// equivalent, such as "é" written precomposed or as "e" and a combining
+// acute accent, are the same identifier. The source text of a token is
+// left as is.
+//
+// Only the ASCII digits 0-9 are numeric. Other decimal digits, such as
+// '٣' (ARABIC-INDIC DIGIT THREE), may appear in identifiers but are
+// invalid in number literals.
+
+// isIdentPart returns true if the rune can follow the first character of
+// an identifier.
+func isIdentPart(r rune) bool {
+	if r < utf8.RuneSelf {
+		return isASCIIIdent(byte(r))
+	}
+	return unicode.In(r, unicode.L, unicode.Nd, unicode.Mn, unicode.Mc, unicode.Pc)
+}
+
+// checkIdent records a warning if a non-ASCII identifier could be mistaken
+// for a different one. This is a simplified form of the checks recommended
+// by UAX #31 and Unicode Technical Standard #39: identifiers should either
+// be written in a single script or in a common combination of scripts, such
+// as Han and Katakana, and a non-Latin identifier shouldn't consist only of
+// letters that look like Latin ones.
+func (l *Lexer) checkIdent(ident string) {
+	var scripts []string
+	for _, r := range ident {
+		if s := scriptOf(r); s != "" && !containsString(scripts, s) {
+			scripts = append(scripts, s)
+		}
+	}
+	sort.Strings(scripts)
+
+	switch {
+	case !allowedScripts(scripts):
+		l.warn(fmt.Errorf("mixed-script identifier: %s (%s)", ident, strings.Join(scripts, ", ")))
+	case len(scripts) == 1 && scripts[0] != "Latin":
+		skel, ok := latinSkeleton(ident)
+		if ok {
+			l.warn(fmt.Errorf("confusable identifier: %s looks like %s", ident, skel))
+		}
+	}
+}
+
+// warn records a warning about the token being read.
+func (l *Lexer) warn(err error) {
+	l.warns = append(l.warns, l.lexErrAt(err, l.tokLine, l.tokCol).(*Error))
+}
+
+// scriptOf returns the name of the Unicode script of the rune or "" if the
+// rune is used with many scripts, like digits, or takes on the script of
+// the preceding character, like combining marks.
+func scriptOf(r rune) string {
+	if r < utf8.RuneSelf {
+		if 'a' <= r && r <= 'z' || 'A' <= r && r <= 'Z' {
+			return "Latin"
+		}
+		return ""
+	}
+
+	for name, table := range unicode.Scripts {
+		if name != "Common" && name != "Inherited" && unicode.Is(table, r) {
+			return name
+		}
+	}
+	return ""
+}
+
+// scriptSets are the combinations of scripts that identifiers may mix, in
+// sorted order. They're the "Highly Restrictive" level of UTS #39.
+var scriptSets = [][]string{
+	{"Han", "Hiragana", "Katakana", "Latin"},
+	{"Bopomofo", "Han", "Latin"},
+	{"Han", "Hangul", "Latin"},
+}
+
+// allowedScripts returns true if an identifier may use all of the scripts.
+func allowedScripts(scripts []string) bool {
+	if len(scripts) <= 1 {
+		return true
+	}
+
+	for _, set := range scriptSets {
+		ok := true
+		for _, s := range scripts {
+			ok = ok && containsString(set, s)
+		}
+		if ok {
+			return true
+		}
+	}
+	return false
+}
+
+// latinSkeleton returns ident with each letter replaced by the Latin
+// letter it looks like. ok is false if any letter doesn't look like a
+// Latin one.
+func latinSkeleton(ident string) (skel string, ok bool) {
+	var sb strings.Builder
+	for _, r := range ident {
+		if lat, found := latinLookalikes[r]; found {
+			r = lat
+		} else if scriptOf(r) != "" {
+			return "", false
+		}
+		sb.WriteRune(r)
+	}
+	return sb.String(), true
+}
+
+// latinLookalikes maps Cyrillic and Greek letters to the Latin letters they
+// can't be told apart from in most fonts. It's a small subset of the UTS #39
+// confusables data.
+var latinLookalikes = map[rune]rune{
+	// Cyrillic
+	'а': 'a', 'с': 'c', 'ԁ': 'd', 'е': 'e', 'һ': 'h', 'і': 'i', 'ј': 'j',
+	'ӏ': 'l', 'о': 'o', 'р': 'p', 'ԛ': 'q', 'ѕ': 's', 'ԝ': 'w', 'х': 'x',
+	'у': 'y',
+	'А': 'A', 'В': 'B', 'С': 'C', 'Е': 'E', 'Н': 'H', 'І': 'I', 'Ј': 'J',
+	'К': 'K', 'М': 'M', 'О': 'O', 'Р': 'P', 'Ԛ': 'Q', 'Ѕ': 'S', 'Т': 'T',
+	'Ԝ': 'W', 'Х': 'X', 'Ү': 'Y',
+
+	// Greek
+	'α': 'a', 'ι': 'i', 'κ': 'k', 'ν': 'v', 'ο': 'o', 'ρ': 'p', 'υ': 'u',
+	'Α': 'A', 'Β': 'B', 'Ε': 'E', 'Η': 'H', 'Ι': 'I', 'Κ': 'K', 'Μ': 'M',
+	'Ν': 'N', 'Ο': 'O', 'Ρ': 'P', 'Τ': 'T', 'Υ': 'Y', 'Χ': 'X', 'Ζ': 'Z',
+}
+
+// containsString returns true if ss contains s.
+func containsString(ss []string, s string) bool {
+	for _, t := range ss {
+		if t == s {
+			return true
+		}
+	}
+	return false
+}
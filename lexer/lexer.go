@@ -2,50 +2,163 @@ package lexer
 
 import (
 	"bufio"
+	"errors"
 	"fmt"
 	"io"
+	"math/big"
 	"os"
 	"strconv"
 	"strings"
 	"unicode"
 	"unicode/utf8"
+
+	"golang.org/x/text/unicode/norm"
 )
 
 // Lexer lexes / tokenizes Monkey language.
 type Lexer struct {
 	filename string
-	r        *bufio.Reader
+	r        *bufio.Reader // nil if reading from src
+	src      string
 	closer   io.Closer
+	mode     Mode
+	cfg      *Config
+	ops      uint64 // cfg.Operators as a bit set, see Config.operatorSet
 
 	line int
 	col  int
+	off  int
+
+	// Start position of the token being read.
+	tokLine int
+	tokCol  int
+	tokOff  int
+
+	tok Token // last token read
 
 	currune rune
-	nxtrune rune
 
-	curtok *Token
-	nxttok *Token
+	// Source text of the token being read, if reading from r.
+	raw []byte
+
+	// Tokens read ahead by PeekN and, while marks are outstanding, tokens
+	// already returned that Reset may rewind to. The ring buffer holds
+	// size tokens starting at head, the first pos of which have been
+	// returned. Its length is always a power of 2.
+	ring  []*Token
+	head  int
+	size  int
+	pos   int
+	index int     // number of tokens returned so far
+	marks []int   // indexes of outstanding marks
+	toks  []Token // tokens allocated for the ring buffer but not yet used
+
+	errs  []*Error // errors recorded in RecoverErrors mode
+	warns []*Error // warnings recorded in WarnConfusables mode
+
+	// Number of unclosed braces in each expression embedded in a template
+	// literal, innermost last.
+	tmpl []int
 }
 
-// New returns a new instance of a Monkey language lexer.
-func New(filename string, r io.Reader) *Lexer {
+// New returns a new instance of a Monkey language lexer. The lexer accepts
+// the dialect defined by cfg, if given, or the full language otherwise.
+func New(filename string, r io.Reader, cfg ...*Config) *Lexer {
 	closer, _ := r.(io.Closer)
+	c := config(cfg)
 	return &Lexer{
 		filename: filename,
 		r:        bufio.NewReader(r),
 		closer:   closer,
+		cfg:      c,
+		ops:      c.operatorSet(),
 		line:     1,
 		col:      1,
 	}
 }
 
-// Open opens a Monkey language script file and returns a lexer.
-func Open(filename string) (*Lexer, error) {
+// NewBytes returns a new lexer that reads from an in-memory script. It's
+// much faster than New: the source is copied once, and identifiers,
+// literals and other token text are sliced out of the copy rather than
+// allocated per token. Combined with Scan, lexing doesn't allocate at all
+// except for string literals containing escape sequences, numbers with '_'
+// separators, big integers and errors. As with New, cfg optionally
+// selects a dialect.
+func NewBytes(filename string, src []byte, cfg ...*Config) *Lexer {
+	c := config(cfg)
+	return &Lexer{
+		filename: filename,
+		src:      string(src),
+		cfg:      c,
+		ops:      c.operatorSet(),
+		line:     1,
+		col:      1,
+	}
+}
+
+// config returns the Config passed to a constructor or the default one.
+func config(cfg []*Config) *Config {
+	if len(cfg) > 0 && cfg[0] != nil {
+		return cfg[0]
+	}
+	return defaultConfig
+}
+
+// Mode controls optional lexer behavior. Modes can be combined with "|".
+type Mode uint
+
+const (
+	// ScanComments returns comments as COMMENT tokens instead of skipping
+	// them.
+	ScanComments Mode = 1 << iota
+
+	// RecoverErrors records lexical errors, such as invalid characters or
+	// malformed literals, instead of returning them. The offending text is
+	// returned as an ILLEGAL token and lexing continues after it. Recorded
+	// errors are available from Errors. Errors reading the input are still
+	// returned.
+	RecoverErrors
+
+	// ScanTrivia attaches the whitespace and comments around each token to
+	// the token, along with the token's source text, so that the input can
+	// be reproduced exactly from the tokens. See Token.FullText. Comments
+	// are only trivia if ScanComments isn't set. In RecoverErrors mode, an
+	// unterminated comment is recorded as an error but kept as trivia.
+	ScanTrivia
+
+	// WarnConfusables records a warning for each identifier that mixes
+	// scripts or could be confused with a Latin identifier, such as "pаypal"
+	// with a Cyrillic 'а'. Warnings are available from Warnings and don't
+	// affect lexing.
+	WarnConfusables
+)
+
+// SetMode sets the lexer's mode. It should be called before reading any
+// tokens.
+func (l *Lexer) SetMode(m Mode) {
+	l.mode = m
+}
+
+// Errors returns the errors recorded in RecoverErrors mode, in the order
+// they were found.
+func (l *Lexer) Errors() []*Error {
+	return l.errs
+}
+
+// Warnings returns the warnings recorded in WarnConfusables mode, in the
+// order they were found.
+func (l *Lexer) Warnings() []*Error {
+	return l.warns
+}
+
+// Open opens a Monkey language script file and returns a lexer for the
+// dialect defined by cfg, if given.
+func Open(filename string, cfg ...*Config) (*Lexer, error) {
 	f, err := os.Open(filename)
 	if err != nil {
 		return nil, err
 	}
-	return New(filename, f), nil
+	return New(filename, f, cfg...), nil
 }
 
 // Close closes the lexer and underlying reader if it supports closing.
@@ -58,236 +171,1093 @@ func (l *Lexer) Close() error {
 
 // Next returns the next Token from the input.
 func (l *Lexer) Next() (*Token, error) {
-	if l.nxttok != nil {
-		l.curtok = l.nxttok
-		l.nxttok = nil
-		return l.curtok, nil
-	}
-
-	tok, err := l.readTok()
+	tok, err := l.peekAt(0)
 	if err != nil {
 		return nil, err
 	}
 
-	l.curtok = tok
+	l.consume()
 
 	return tok, nil
 }
 
+// Scan is like Next but returns the token by value, which saves allocating
+// a Token per call unless tokens have been peeked or marks are outstanding.
+func (l *Lexer) Scan() (Token, error) {
+	if l.size == 0 && len(l.marks) == 0 {
+		if err := l.readTok(); err != nil {
+			return Token{}, err
+		}
+		l.index++
+		return l.tok, nil
+	}
+
+	tok, err := l.Next()
+	if err != nil {
+		return Token{}, err
+	}
+
+	return *tok, nil
+}
+
 // Peek returns the next Token without reading past it.
 func (l *Lexer) Peek() (*Token, error) {
-	if l.nxttok != nil {
-		return l.nxttok, nil
+	return l.PeekN(1)
+}
+
+// PeekN returns the nth next Token without reading past it. PeekN(1) is
+// the same as Peek. Like Next, Peek and PeekN return each error only once:
+// an error is discarded once returned, and the tokens after it can still be
+// read.
+func (l *Lexer) PeekN(n int) (*Token, error) {
+	if n < 1 {
+		panic("lexer: PeekN called with n < 1")
+	}
+
+	var tok *Token
+	for i := 0; i < n; i++ {
+		var err error
+		if tok, err = l.peekAt(i); err != nil {
+			return nil, err
+		}
+	}
+
+	return tok, nil
+}
+
+// Mark is a checkpoint in a lexer's token stream, returned by Lexer.Mark.
+type Mark struct {
+	index int
+}
+
+// Mark returns a checkpoint at the current position in the token stream.
+// Tokens returned after it are kept so that Reset can rewind to it, e.g.,
+// to backtrack after trying to parse one alternative of an ambiguous
+// grammar rule. Every mark must be either reset or released, in the reverse
+// order they were made. Errors aren't kept, so they aren't returned again
+// after a reset.
+func (l *Lexer) Mark() Mark {
+	l.marks = append(l.marks, l.index)
+	return Mark{index: l.index}
+}
+
+// Reset rewinds the token stream to the mark m and releases m.
+func (l *Lexer) Reset(m Mark) {
+	l.checkMark(m)
+	l.pos -= l.index - m.index
+	l.index = m.index
+	l.Release(m)
+}
+
+// Release releases the mark m without rewinding the token stream.
+func (l *Lexer) Release(m Mark) {
+	l.checkMark(m)
+	l.marks = l.marks[:len(l.marks)-1]
+
+	if len(l.marks) == 0 {
+		for ; l.pos > 0; l.pos-- {
+			l.pop()
+		}
 	}
+}
 
-	tok, err := l.readTok()
+// checkMark panics if m isn't the most recent outstanding mark.
+func (l *Lexer) checkMark(m Mark) {
+	if n := len(l.marks); n == 0 || l.marks[n-1] != m.index {
+		panic("lexer: marks must be reset or released in reverse order")
+	}
+}
+
+// peekAt returns the token i tokens after the next one, reading ahead as
+// needed.
+func (l *Lexer) peekAt(i int) (*Token, error) {
+	for l.size <= l.pos+i {
+		if err := l.readTok(); err != nil {
+			return nil, err
+		}
+
+		// Allocating tokens in blocks is much faster than one at a time.
+		if len(l.toks) == 0 {
+			l.toks = make([]Token, 32)
+		}
+		tok := &l.toks[0]
+		l.toks = l.toks[1:]
+
+		*tok = l.tok
+		l.push(tok)
+	}
+
+	return l.ring[(l.head+l.pos+i)&(len(l.ring)-1)], nil
+}
+
+// consume advances past the next buffered token. It's only kept if marks
+// are outstanding.
+func (l *Lexer) consume() {
+	l.index++
+	if len(l.marks) > 0 {
+		l.pos++
+		return
+	}
+	l.pop()
+}
+
+// push adds a token to the end of the ring buffer, growing it if it's full.
+func (l *Lexer) push(tok *Token) {
+	if l.size == len(l.ring) {
+		n := 2 * len(l.ring)
+		if n == 0 {
+			n = 4
+		}
+
+		ring := make([]*Token, n)
+		for i := 0; i < l.size; i++ {
+			ring[i] = l.ring[(l.head+i)&(len(l.ring)-1)]
+		}
+		l.ring, l.head = ring, 0
+	}
+
+	l.ring[(l.head+l.size)&(len(l.ring)-1)] = tok
+	l.size++
+}
+
+// pop removes the token at the front of the ring buffer.
+func (l *Lexer) pop() {
+	l.ring[l.head] = nil
+	l.head = (l.head + 1) & (len(l.ring) - 1)
+	l.size--
+}
+
+// readTok reads in the next token from input and stores it in l.tok.
+func (l *Lexer) readTok() error {
+	if l.mode&ScanTrivia == 0 {
+		return l.scanTok()
+	}
+
+	leading, err := l.readTrivia(false)
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	l.nxttok = tok
+	if err := l.scanTok(); err != nil {
+		return err
+	}
 
-	return tok, nil
+	text := l.text()
+
+	var trailing []Trivia
+	if !l.tok.EOF() {
+		if trailing, err = l.readTrivia(true); err != nil {
+			return err
+		}
+	}
+
+	l.tok.Text, l.tok.Leading, l.tok.Trailing = text, leading, trailing
+
+	return nil
 }
 
-// readTok reads in the next token from input.
-func (l *Lexer) readTok() (*Token, error) {
-	if err := l.skipSpace(); err != nil {
+// readTrivia reads whitespace and comments. A token's trailing trivia ends
+// before the next newline, which begins the next token's leading trivia.
+func (l *Lexer) readTrivia(trailing bool) ([]Trivia, error) {
+	// Comments are read as tokens, which replaces l.tok.
+	tok := l.tok
+	defer func() { l.tok = tok }()
+
+	var trivia []Trivia
+	for {
+		l.tokLine, l.tokCol, l.tokOff = l.line, l.col, l.off
+		l.raw = l.raw[:0]
+
+		isComment, err := l.peekComment()
+		if err != nil {
+			return nil, err
+		}
+
+		if isComment {
+			l.readRune()
+			if err := l.readCommentTok(); err != nil {
+				return nil, err
+			}
+			trivia = append(trivia, Trivia{Comment: true, Text: l.text()})
+			continue
+		}
+
+		for {
+			r, err := l.peakRune()
+			if err != nil && err != io.EOF {
+				return nil, l.lexErr(err)
+			}
+
+			if err == io.EOF || !unicode.IsSpace(r) || trailing && r == '\n' {
+				break
+			}
+
+			l.readRune()
+		}
+
+		if l.off == l.tokOff {
+			return trivia, nil
+		}
+
+		trivia = append(trivia, Trivia{Text: l.text()})
+	}
+}
+
+// peekComment returns true if the next runes begin a comment that should be
+// read as trivia.
+func (l *Lexer) peekComment() (bool, error) {
+	if l.mode&ScanComments != 0 {
+		return false, nil
+	}
+
+	r, err := l.peakRune()
+	if err != nil && err != io.EOF {
+		return false, l.lexErr(err)
+	}
+
+	if r != '/' {
+		return false, nil
+	}
+
+	var nxt byte
+	if l.r == nil {
+		if l.off+1 < len(l.src) {
+			nxt = l.src[l.off+1]
+		}
+	} else if b, _ := l.r.Peek(2); len(b) > 1 {
+		nxt = b[1]
+	}
+
+	return nxt == '/' || nxt == '*', nil
+}
+
+// scanTok reads in the next token from input, skipping any whitespace and,
+// unless ScanComments is set, comments before it.
+func (l *Lexer) scanTok() error {
+	err := l.skipSpace()
+	l.tokLine, l.tokCol, l.tokOff = l.line, l.col, l.off
+	l.raw = l.raw[:0]
+	if err != nil {
 		if err != io.EOF {
-			return nil, l.lexErr(err)
+			return l.lexErr(err)
 		}
-		return l.newTok(EOF, "", 0, 0)
+		return l.emit(EOF, "")
 	}
 
 	r, err := l.readRune()
 	if err != nil {
 		if err != io.EOF {
-			return nil, l.lexErr(err)
+			return l.lexErr(err)
 		}
-		return l.newTok(EOF, "", 0, 0)
+		return l.emit(EOF, "")
 	}
 
 	switch r {
-	case ';', '+', '-', '*', '/', '<', '>',
-		'(', ')', '{', '}', '[', ']', ',':
-		return l.newTok(runeTokenTypes[r], string(r), 0, 0)
-	case '=':
+	case ';', '(', ')', '[', ']', ',', ':':
+		return l.emit(runeTokenTypes[r], l.text())
+	case '+', '-', '*', '%', '^':
+		return l.emitOp(runeTokenTypes[r])
+	case '{', '}':
+		// Track braces inside expressions embedded in template literals to
+		// find the '}' that ends each one.
+		if n := len(l.tmpl); n > 0 {
+			switch {
+			case r == '{':
+				l.tmpl[n-1]++
+			case l.tmpl[n-1] > 0:
+				l.tmpl[n-1]--
+			default:
+				l.tmpl = l.tmpl[:n-1]
+				return l.readTextTok('`', TEMPLATE_TAIL, TEMPLATE_MIDDLE)
+			}
+		}
+		return l.emit(runeTokenTypes[r], l.text())
+	case '=', '!', '<', '>', '&', '|':
+		nxt, err := l.peakRune()
+		if err != nil && err != io.EOF {
+			return l.lexErr(err)
+		}
+
+		if nxt == '=' || nxt == r {
+			if t, ok := twoRuneTokenTypes[[2]rune{r, nxt}]; ok {
+				l.readRune()
+				return l.emitOp(t)
+			}
+		}
+
+		return l.emitOp(runeTokenTypes[r])
+	case '/':
 		if r, err = l.peakRune(); err != nil && err != io.EOF {
-			return nil, l.lexErr(err)
+			return l.lexErr(err)
 		}
 
-		if r == '=' {
-			line, col := l.line, l.col
-			l.readRune()
-			return l.newTok(EQ, "==", line, col)
+		if r != '/' && r != '*' {
+			return l.emitOp(DIV)
+		}
+
+		err := l.readCommentTok()
+		if err != nil || l.tok.Type == ILLEGAL || l.mode&ScanComments != 0 {
+			return err
 		}
 
-		return l.newTok(ASSIGN, "=", 0, 0)
-	case '!':
+		return l.scanTok()
+	case '"':
+		return l.readTextTok('"', STRING, STRING)
+	case '`':
+		return l.readTextTok('`', TEMPLATE, TEMPLATE_HEAD)
+	case '.':
 		if r, err = l.peakRune(); err != nil && err != io.EOF {
-			return nil, l.lexErr(err)
+			return l.lexErr(err)
 		}
 
-		if r == '=' {
-			line, col := l.line, l.col
-			l.readRune()
-			return l.newTok(NEQ, "!=", line, col)
+		if isDigit(r) {
+			return l.readNumTok()
 		}
 
-		return l.newTok(NOT, "!", 0, 0)
+		return l.illegal(l.invalidTok())
 	default:
 		if isLetter(r) {
 			return l.readIdentTok()
 		} else if isDigit(r) {
 			return l.readNumTok()
 		}
-		return l.newTok(ILLEGAL, string(r), 0, 0)
+		return l.illegal(l.invalidTok())
 	}
 }
 
-// readIdentTok reads and returns an identifier token.
-func (l *Lexer) readIdentTok() (*Token, error) {
-	var sb strings.Builder
-
-	startCol := l.col - 1
-	if _, err := sb.WriteRune(l.currune); err != nil {
-		return nil, l.lexErr(err)
-	}
+// readIdentTok reads and returns an identifier or keyword token. Non-ASCII
+// identifiers are normalized to NFC.
+func (l *Lexer) readIdentTok() error {
+	l.skipASCII(isASCIIIdent)
 
+	ascii := l.currune < utf8.RuneSelf
 	for {
 		r, err := l.peakRune()
 		if err != nil {
 			if err == io.EOF {
 				break
 			}
-			return nil, l.lexErr(err)
+			return l.lexErr(err)
 		}
 
-		if !isLetter(r) && !isDigit(r) {
+		if !isIdentPart(r) {
 			break
 		}
 
-		r, _ = l.readRune()
-		if _, err := sb.WriteRune(r); err != nil {
-			return nil, l.lexErr(err)
-		}
+		ascii = ascii && r < utf8.RuneSelf
+		l.readRune()
 	}
 
-	ident := sb.String()
-	tokType := lookupIdentType(ident)
+	ident := l.text()
+	if !ascii {
+		if !l.cfg.UnicodeIdents {
+			return l.illegal(l.lexErrAt(fmt.Errorf("non-ASCII identifier: %s", ident), l.tokLine, l.tokCol))
+		}
 
-	tok, _ := l.newTok(tokType, ident, 0, 0)
-	tok.Col = startCol
+		ident = norm.NFC.String(ident)
 
-	return tok, nil
-}
+		if l.mode&WarnConfusables != 0 {
+			l.checkIdent(ident)
+		}
+	}
 
-// readNumTok reads and returns any supported type of number token.
-func (l *Lexer) readNumTok() (*Token, error) {
-	// TODO: add float support?
-	return l.readIntTok()
+	if t, ok := l.cfg.Keywords[ident]; ok {
+		return l.emit(t, ident)
+	}
+
+	return l.emit(IDENT, ident)
 }
 
-// readIntTok reads and returns an integer token.
-func (l *Lexer) readIntTok() (*Token, error) {
-	var sb strings.Builder
+// readNumTok reads and returns an INT or FLOAT token. The first digit, or
+// the '.' of a float such as ".5", has already been read. Floats have a
+// fraction, an exponent or both, e.g., "1.5", "1e-9", "2.5E3". Digits may be
+// separated by underscores, e.g., "1_000_000".
+func (l *Lexer) readNumTok() error {
+	if l.currune == '0' {
+		r, err := l.peakRune()
+		if err != nil && err != io.EOF {
+			return l.lexErr(err)
+		}
+
+		switch r {
+		case 'x', 'X', 'o', 'O', 'b', 'B':
+			return l.readIntTok()
+		}
+	}
+
+	isFloat := l.currune == '.'
 
-	startCol := l.col - 1
-	if _, err := sb.WriteRune(l.currune); err != nil {
-		return nil, l.lexErr(err)
+	if _, err := l.readDigits(); err != nil {
+		return err
 	}
 
+	// Fraction
+	r, err := l.peakRune()
+	if err != nil && err != io.EOF {
+		return l.lexErr(err)
+	}
+
+	if r == '.' && !isFloat {
+		isFloat = true
+		l.readRune()
+
+		if _, err := l.readDigits(); err != nil {
+			return err
+		}
+
+		if r, err = l.peakRune(); err != nil && err != io.EOF {
+			return l.lexErr(err)
+		}
+	}
+
+	// Exponent
+	if r == 'e' || r == 'E' {
+		isFloat = true
+		l.readRune()
+
+		if r, err = l.peakRune(); err != nil && err != io.EOF {
+			return l.lexErr(err)
+		}
+
+		if r == '+' || r == '-' {
+			l.readRune()
+		}
+
+		n, err := l.readDigits()
+		if err != nil {
+			return err
+		}
+
+		if n == 0 {
+			return l.illegal(l.lexErr(errors.New("exponent has no digits")))
+		}
+	}
+
+	lit := l.text()
+	var sep bool
+	for i := 0; i < len(lit); i++ {
+		if c := lit[i]; c >= utf8.RuneSelf {
+			r, _ := utf8.DecodeRuneInString(lit[i:])
+			col := l.tokCol + utf8.RuneCountInString(lit[:i])
+			return l.illegal(l.lexErrAt(fmt.Errorf("invalid digit %q in decimal literal", r), l.tokLine, col))
+		} else if c == '_' {
+			sep = true
+		}
+	}
+
+	digits := lit
+	if sep {
+		if i := badSeparator(lit, 0, isDigit); i >= 0 {
+			return l.illegal(l.lexErrAt(errors.New("'_' must separate successive digits"), l.tokLine, l.tokCol+i))
+		}
+		digits = strings.Replace(lit, "_", "", -1)
+	}
+
+	if isFloat {
+		return l.floatTok(lit)
+	}
+
+	return l.intTok(lit, digits, 10)
+}
+
+// readIntTok reads and returns a hexadecimal ("0x"), octal ("0o") or binary
+// ("0b") integer token. The leading '0' has already been read and the base
+// prefix letter is next. Any letters or digits following the prefix are
+// part of the literal so that malformed literals like "0b102" are reported
+// as a whole rather than split into several tokens.
+func (l *Lexer) readIntTok() error {
+	prefix, _ := l.readRune()
+
 	for {
 		r, err := l.peakRune()
 		if err != nil {
 			if err == io.EOF {
 				break
 			}
-			return nil, l.lexErr(err)
+			return l.lexErr(err)
 		}
 
-		if !isDigit(r) {
+		if !isIdentPart(r) {
 			break
 		}
 
-		r, _ = l.readRune()
-		if _, err := sb.WriteRune(r); err != nil {
-			return nil, l.lexErr(err)
+		l.readRune()
+	}
+
+	var base int
+	var name string
+	switch unicode.ToLower(prefix) {
+	case 'x':
+		base, name = 16, "hexadecimal"
+	case 'o':
+		base, name = 8, "octal"
+	case 'b':
+		base, name = 2, "binary"
+	}
+
+	lit := l.text()
+	digits := strings.Replace(lit[2:], "_", "", -1)
+	if digits == "" {
+		return l.illegal(l.lexErrAt(fmt.Errorf("%s literal has no digits", name), l.tokLine, l.tokCol))
+	}
+
+	for i, r := range lit {
+		if i < 2 || r == '_' {
+			continue
+		}
+
+		if d := hexVal(r); d < 0 || d >= base {
+			col := l.tokCol + utf8.RuneCountInString(lit[:i])
+			return l.illegal(l.lexErrAt(fmt.Errorf("invalid digit %q in %s literal", r, name), l.tokLine, col))
+		}
+	}
+
+	if i := badSeparator(lit, 2, func(r rune) bool { return hexVal(r) >= 0 }); i >= 0 {
+		return l.illegal(l.lexErrAt(errors.New("'_' must separate successive digits"), l.tokLine, l.tokCol+i))
+	}
+
+	return l.intTok(lit, digits, base)
+}
+
+// MaxIntBits is the maximum size, in bits, of an integer literal. Integers
+// that don't fit in an int are still supported, up to this limit, as big
+// integers.
+const MaxIntBits = 1 << 16
+
+// intTok returns an INT token for the integer literal lit, whose digits (in
+// the given base, without prefix or separators) are passed separately.
+// Literals too large for an int are stored in the token's Big field.
+func (l *Lexer) intTok(lit, digits string, base int) error {
+	l.emit(INT, lit)
+
+	// Short decimal literals, the common case, can't overflow and are
+	// much faster to convert directly than with strconv.
+	if base == 10 && len(digits) < 10 {
+		n := 0
+		for i := 0; i < len(digits); i++ {
+			n = n*10 + int(digits[i]-'0')
 		}
+		l.tok.Int = n
+		return nil
 	}
 
-	i, err := strconv.Atoi(sb.String())
+	i, err := strconv.ParseInt(digits, base, strconv.IntSize)
+	if err == nil {
+		l.tok.Int = int(i)
+		return nil
+	}
+
+	b, ok := new(big.Int).SetString(digits, base)
+	if !ok || b.BitLen() > MaxIntBits {
+		return l.illegal(l.lexErrAt(fmt.Errorf("integer literal out of range: %s", truncate(lit, 20)), l.tokLine, l.tokCol))
+	}
+
+	l.tok.Big = b
+
+	return nil
+}
+
+// floatTok returns a FLOAT token for the float literal s.
+func (l *Lexer) floatTok(s string) error {
+	f, err := strconv.ParseFloat(s, 64)
 	if err != nil {
-		return nil, err
+		return l.illegal(l.lexErrAt(fmt.Errorf("float literal out of range: %s", s), l.tokLine, l.tokCol))
 	}
 
-	tok, _ := l.newTok(INT, sb.String(), 0, 0)
-	tok.Int = i
-	tok.Col = startCol
+	l.emit(FLOAT, s)
+	l.tok.Float = f
 
-	return tok, nil
+	return nil
 }
 
-// newToken returns a new Token.
-func (l *Lexer) newTok(t TokenType, s string, line, col int) (*Token, error) {
-	var err error
-	if t == ILLEGAL {
-		err = l.lexErr(fmt.Errorf("invalid token: %s", s))
+// readDigits reads decimal digits and '_' separators until it reaches
+// anything else and returns the number of runes read.
+func (l *Lexer) readDigits() (int, error) {
+	for n := l.skipASCII(isASCIIDigitSep); ; n++ {
+		r, err := l.peakRune()
+		if err != nil {
+			if err == io.EOF {
+				return n, nil
+			}
+			return n, l.lexErr(err)
+		}
+
+		if !isDigit(r) && r != '_' {
+			return n, nil
+		}
+
+		l.readRune()
 	}
+}
+
+// readCommentTok reads and returns a "// line" or "/* block */" comment
+// token. The leading '/' has already been read. Block comments nest, so
+// "/* a /* b */ c */" is a single comment. The token's String value holds the
+// comment's full text, including delimiters but excluding the newline ending
+// a line comment.
+func (l *Lexer) readCommentTok() error {
+	r, _ := l.readRune()
+
+	if r == '/' {
+		for {
+			r, err := l.peakRune()
+			if err != nil {
+				if err == io.EOF {
+					break
+				}
+				return l.lexErr(err)
+			}
+
+			if r == '\n' {
+				break
+			}
+
+			l.readRune()
+		}
 
-	if line == 0 {
-		line = l.line
+		return l.emit(COMMENT, l.text())
 	}
 
-	if col == 0 {
-		col = l.col
+	for depth := 1; depth > 0; {
+		r, err := l.readRune()
+		if err != nil {
+			if err == io.EOF {
+				return l.illegal(l.lexErrAt(errors.New("unterminated comment"), l.tokLine, l.tokCol))
+			}
+			return l.lexErr(err)
+		}
+
+		if r != '/' && r != '*' {
+			continue
+		}
+
+		nxt, err := l.peakRune()
+		if err != nil && err != io.EOF {
+			return l.lexErr(err)
+		}
+
+		if r == '/' && nxt == '*' {
+			depth++
+		} else if r == '*' && nxt == '/' {
+			depth--
+		} else {
+			continue
+		}
+
+		l.readRune()
 	}
 
-	return NewToken(t, l.filename, line, col-1, s), err
+	return l.emit(COMMENT, l.text())
+}
+
+// readTextTok reads and returns a string literal token or a template
+// literal token. The opening '"' or '`', or the '}' ending an expression
+// embedded in a template, has already been read. The text ends with the
+// closing quote, in which case an end token is returned, or, in templates,
+// with a "${" beginning an embedded expression, in which case an interp
+// token is returned. The token's String value holds the text, without
+// delimiters, with all escape sequences decoded. In RecoverErrors mode, text
+// containing invalid escape sequences is read up to its end and returned as
+// a single ILLEGAL token.
+func (l *Lexer) readTextTok(quote rune, end, interp TokenType) error {
+	// The value is only built up separately from the source text once an
+	// escape sequence is seen.
+	var sb strings.Builder
+	var escaped bool
+	var escErr error
+
+	for {
+		r, err := l.readRune()
+		if err != nil {
+			if err != io.EOF {
+				return l.lexErr(err)
+			}
+			what := "string"
+			if quote == '`' {
+				what = "template literal"
+			}
+			return l.illegal(l.lexErrAt(fmt.Errorf("unterminated %s", what), l.tokLine, l.tokCol))
+		}
+
+		t, delim := EOF, 0
+		switch r {
+		case quote:
+			t, delim = end, 1
+		case '$':
+			nxt, err := l.peakRune()
+			if err != nil && err != io.EOF {
+				return l.lexErr(err)
+			}
+			if quote == '`' && nxt == '{' {
+				l.readRune()
+				l.tmpl = append(l.tmpl, 0)
+				t, delim = interp, 2
+			}
+		case '\\':
+			if !escaped {
+				text := l.text()
+				sb.WriteString(text[1 : len(text)-1])
+				escaped = true
+			}
+			// An invalid escape is reported once the closing delimiter
+			// has been read, so lexing resumes after the literal.
+			if r, err = l.readEscape(quote); err != nil && escErr == nil {
+				escErr = err
+			}
+		}
+
+		if t != EOF {
+			if escErr != nil {
+				return l.illegal(escErr)
+			}
+			if !escaped {
+				text := l.text()
+				return l.emit(t, text[1:len(text)-delim])
+			}
+			return l.emit(t, sb.String())
+		}
+
+		if escaped {
+			sb.WriteRune(r)
+		}
+	}
+}
+
+// readEscape reads the remainder of an escape sequence inside a string or
+// template literal and returns the rune it represents. The backslash has
+// already been read. quote is the literal's quote character.
+func (l *Lexer) readEscape(quote rune) (rune, error) {
+	line, col := l.line, l.col-1
+
+	r, err := l.readRune()
+	if err != nil {
+		if err == io.EOF {
+			return 0, l.lexErrAt(errors.New("unterminated escape sequence"), line, col)
+		}
+		return 0, l.lexErr(err)
+	}
+
+	switch r {
+	case 'n':
+		return '\n', nil
+	case 't':
+		return '\t', nil
+	case 'r':
+		return '\r', nil
+	case '"', '\\', quote:
+		return r, nil
+	case '$':
+		if quote == '`' {
+			return r, nil
+		}
+	case 'u':
+		return l.readUnicodeEscape(line, col)
+	}
+
+	return 0, l.lexErrAt(fmt.Errorf("invalid escape sequence: \\%c", r), line, col)
+}
+
+// readUnicodeEscape reads the "{XXXX}" part of a "\u{XXXX}" escape sequence
+// and returns the code point it represents. line and col are the position
+// of the escape's backslash.
+func (l *Lexer) readUnicodeEscape(line, col int) (rune, error) {
+	invalid := func() error {
+		return l.lexErrAt(errors.New("invalid unicode escape sequence"), line, col)
+	}
+
+	if r, err := l.peakRune(); err != nil || r != '{' {
+		return 0, invalid()
+	}
+	l.readRune()
+
+	var cp rune
+	for n := 0; ; n++ {
+		r, err := l.peakRune()
+		if err != nil {
+			return 0, invalid()
+		}
+
+		if r == '}' {
+			if n == 0 {
+				return 0, invalid()
+			}
+			l.readRune()
+			break
+		}
+
+		d := hexVal(r)
+		if d < 0 || n == 6 {
+			return 0, invalid()
+		}
+		l.readRune()
+
+		cp = cp<<4 | rune(d)
+	}
+
+	if cp > unicode.MaxRune || 0xD800 <= cp && cp <= 0xDFFF {
+		return 0, invalid()
+	}
+
+	return cp, nil
+}
+
+// emit sets l.tok to a new token spanning from the start of the token being
+// read to the current position. It always returns nil so that token readers
+// can end with "return l.emit(...)".
+func (l *Lexer) emit(t TokenType, s string) error {
+	// Setting fields individually is much faster than assigning a Token
+	// literal, which is significant when reading from src.
+	tok := &l.tok
+	tok.Type = t
+	tok.File = l.filename
+	tok.Line, tok.Col, tok.Offset = l.tokLine, l.tokCol, l.tokOff
+	tok.EndLine, tok.EndCol, tok.EndOffset = l.line, l.col, l.off
+	tok.String = s
+	tok.Int, tok.Big, tok.Float = 0, nil, 0
+	return nil
+}
+
+// emitOp emits an operator token of type t if the lexer's dialect allows
+// it. Otherwise, the token is invalid.
+func (l *Lexer) emitOp(t TokenType) error {
+	if l.ops&(1<<uint(t-ASSIGN)) == 0 {
+		return l.illegal(l.invalidTok())
+	}
+	return l.emit(t, l.text())
+}
+
+// invalidTok returns the error for a token that doesn't begin with any
+// valid character.
+func (l *Lexer) invalidTok() error {
+	return l.lexErrAt(fmt.Errorf("invalid token: %s", l.text()), l.tokLine, l.tokCol)
+}
+
+// illegal handles a lexical error in the token being read. Normally, err
+// is returned. In RecoverErrors mode, err is recorded instead and an
+// ILLEGAL token holding the source text read so far is returned.
+func (l *Lexer) illegal(err error) error {
+	if l.mode&RecoverErrors == 0 {
+		return err
+	}
+
+	l.errs = append(l.errs, err.(*Error))
+
+	return l.emit(ILLEGAL, l.text())
+}
+
+// text returns the source text of the token being read.
+func (l *Lexer) text() string {
+	if l.r == nil {
+		return l.src[l.tokOff:l.off]
+	}
+	return string(l.raw)
 }
 
 // readRune returns the next rune.
 func (l *Lexer) readRune() (rune, error) {
-	if l.nxtrune != 0 {
-		l.currune = l.nxtrune
-		l.nxtrune = 0
-	} else {
-		r, _, err := l.r.ReadRune()
-		if err != nil {
-			return 0, err
+	if l.r == nil {
+		r, size := l.decodeRune()
+		if size == 0 {
+			return 0, io.EOF
 		}
 
 		l.currune = r
+		l.off += size
+		l.col++
+		if r == '\n' {
+			l.line++
+			l.col = 1
+		}
+
+		return r, nil
+	}
+
+	c, err := l.r.ReadByte()
+	if err != nil {
+		return 0, err
 	}
 
+	r, size := rune(c), 1
+	if c < utf8.RuneSelf {
+		l.raw = append(l.raw, c)
+	} else {
+		l.r.UnreadByte()
+		b, _ := l.r.Peek(utf8.UTFMax)
+		r, size = utf8.DecodeRune(b)
+
+		// Keep the bytes actually read, rather than the encoding of r, so
+		// that invalid UTF-8 is preserved in the token's text.
+		l.raw = append(l.raw, b[:size]...)
+		l.r.Discard(size)
+	}
+
+	l.currune = r
+	l.off += size
 	l.col++
-	if l.currune == '\n' {
+	if r == '\n' {
 		l.line++
 		l.col = 1
 	}
 
-	return l.currune, nil
+	return r, nil
 }
 
 // peakRune returns the next rune that would be returned by readRune() but
 // leaves it in the input stream.
 func (l *Lexer) peakRune() (rune, error) {
-	if l.nxtrune != 0 {
-		return l.nxtrune, nil
+	if l.r == nil {
+		r, size := l.decodeRune()
+		if size == 0 {
+			return 0, io.EOF
+		}
+		return r, nil
 	}
 
-	r, _, err := l.r.ReadRune()
-	if err != nil {
-		return 0, err
+	r, _, err := l.peekReader()
+	return r, err
+}
+
+// peekReader returns the next rune in r and the bytes encoding it without
+// consuming them. An invalid byte is returned as utf8.RuneError.
+func (l *Lexer) peekReader() (rune, []byte, error) {
+	b, err := l.r.Peek(1)
+	if len(b) == 0 {
+		return 0, nil, err
 	}
 
-	l.nxtrune = r
+	if b[0] < utf8.RuneSelf {
+		return rune(b[0]), b, nil
+	}
 
-	return r, nil
+	b, _ = l.r.Peek(utf8.UTFMax)
+
+	r, size := utf8.DecodeRune(b)
+
+	return r, b[:size], nil
+}
+
+// decodeRune returns the rune at the current offset in src and its size in
+// bytes. The size is 0 at the end of src.
+func (l *Lexer) decodeRune() (rune, int) {
+	if l.off >= len(l.src) {
+		return 0, 0
+	}
+
+	if c := l.src[l.off]; c < utf8.RuneSelf {
+		return rune(c), 1
+	}
+
+	return utf8.DecodeRuneInString(l.src[l.off:])
+}
+
+// skipASCII is a fast path for reading runs of ASCII characters. It
+// advances the lexer past the bytes for which match returns true, which must
+// all be ASCII characters other than newline, and returns the number of
+// bytes skipped.
+func (l *Lexer) skipASCII(match func(byte) bool) int {
+	if l.r != nil {
+		return l.skipASCIIReader(match)
+	}
+
+	start := l.off
+	for l.off < len(l.src) && match(l.src[l.off]) {
+		l.off++
+	}
+
+	n := l.off - start
+	l.col += n
+
+	return n
+}
+
+// skipASCIIReader is skipASCII for reading from r. It scans the bytes
+// already buffered rather than reading them one at a time.
+func (l *Lexer) skipASCIIReader(match func(byte) bool) int {
+	n := 0
+	for {
+		if b, _ := l.r.Peek(1); len(b) == 0 {
+			break
+		}
+
+		b, _ := l.r.Peek(l.r.Buffered())
+		i := 0
+		for i < len(b) && match(b[i]) {
+			i++
+		}
+
+		l.raw = append(l.raw, b[:i]...)
+		l.r.Discard(i)
+		n += i
+
+		if i < len(b) {
+			break
+		}
+	}
+
+	l.off += n
+	l.col += n
+
+	return n
 }
 
 // skipSpace advances the lexer past whitespace.
 func (l *Lexer) skipSpace() error {
+	if l.r == nil {
+		// Fast path for ASCII when reading from src. The position is kept in
+		// locals until the loop ends.
+		off, line, col := l.off, l.line, l.col
+		for ; off < len(l.src); off++ {
+			switch c := l.src[off]; c {
+			case ' ', '\t', '\r':
+				col++
+			case '\n':
+				line++
+				col = 1
+			default:
+				l.off, l.line, l.col = off, line, col
+				if c < utf8.RuneSelf && c != '\v' && c != '\f' {
+					return nil
+				}
+				return l.skipUnicodeSpace()
+			}
+		}
+		l.off, l.line, l.col = off, line, col
+		return io.EOF
+	}
+
+	// Likewise when reading from r, scanning the bytes already buffered.
+	for {
+		b, err := l.r.Peek(1)
+		if len(b) == 0 {
+			return err
+		}
+
+		b, _ = l.r.Peek(l.r.Buffered())
+		for i, c := range b {
+			switch c {
+			case ' ', '\t', '\r':
+				l.col++
+			case '\n':
+				l.line++
+				l.col = 1
+			default:
+				l.off += i
+				l.r.Discard(i)
+				if c < utf8.RuneSelf && c != '\v' && c != '\f' {
+					return nil
+				}
+				return l.skipUnicodeSpace()
+			}
+		}
+
+		l.off += len(b)
+		l.r.Discard(len(b))
+	}
+}
+
+// skipUnicodeSpace advances the lexer past whitespace one rune at a time.
+func (l *Lexer) skipUnicodeSpace() error {
+
 	for {
 		r, err := l.peakRune()
 		if err != nil {
@@ -304,11 +1274,16 @@ func (l *Lexer) skipSpace() error {
 
 // lexErr returns a lexer error.
 func (l *Lexer) lexErr(err error) error {
+	return l.lexErrAt(err, l.line, l.col)
+}
+
+// lexErrAt returns a lexer error at the specified position.
+func (l *Lexer) lexErrAt(err error, line, col int) error {
 	return &Error{
 		Err:  err,
 		File: l.filename,
-		Line: l.line,
-		Col:  l.col,
+		Line: line,
+		Col:  col,
 	}
 }
 
@@ -319,10 +1294,17 @@ type TokenType int
 const (
 	ILLEGAL TokenType = iota
 	EOF
+	COMMENT
 
 	// Identifiers and literals
 	IDENT
 	INT
+	FLOAT
+	STRING
+	TEMPLATE        // "`text`"
+	TEMPLATE_HEAD   // "`text${"
+	TEMPLATE_MIDDLE // "}text${"
+	TEMPLATE_TAIL   // "}text`"
 
 	// Operators
 	ASSIGN // '='
@@ -332,9 +1314,19 @@ const (
 	SUB    // '-'
 	MUL    // '*'
 	DIV    // '/'
+	MOD    // '%'
 	NOT    // '!'
 	LT     // '<'
 	GT     // '>'
+	LTE    // "<="
+	GTE    // ">="
+	AND    // "&&"
+	OR     // "||"
+	BITAND // '&'
+	BITOR  // '|'
+	XOR    // '^'
+	SHL    // "<<"
+	SHR    // ">>"
 
 	// Delimeters
 	SEMICOLON // ';'
@@ -345,6 +1337,7 @@ const (
 	LSQUARE   // '['
 	RSQUARE   // ']'
 	COMMA     // ','
+	COLON     // ':'
 
 	// Keywords
 	ELSE
@@ -363,10 +1356,24 @@ func (t TokenType) String() string {
 		return "ILLEGAL"
 	case EOF:
 		return "EOF"
+	case COMMENT:
+		return "COMMENT"
 	case IDENT:
 		return "IDENT"
 	case INT:
 		return "INT"
+	case FLOAT:
+		return "FLOAT"
+	case STRING:
+		return "STRING"
+	case TEMPLATE:
+		return "TEMPLATE"
+	case TEMPLATE_HEAD:
+		return "TEMPLATE_HEAD"
+	case TEMPLATE_MIDDLE:
+		return "TEMPLATE_MIDDLE"
+	case TEMPLATE_TAIL:
+		return "TEMPLATE_TAIL"
 	case ASSIGN:
 		return "ASSIGN"
 	case EQ:
@@ -381,12 +1388,32 @@ func (t TokenType) String() string {
 		return "MUL"
 	case DIV:
 		return "DIV"
+	case MOD:
+		return "MOD"
 	case NOT:
 		return "NOT"
 	case LT:
 		return "LT"
 	case GT:
 		return "GT"
+	case LTE:
+		return "LTE"
+	case GTE:
+		return "GTE"
+	case AND:
+		return "AND"
+	case OR:
+		return "OR"
+	case BITAND:
+		return "BITAND"
+	case BITOR:
+		return "BITOR"
+	case XOR:
+		return "XOR"
+	case SHL:
+		return "SHL"
+	case SHR:
+		return "SHR"
 	case SEMICOLON:
 		return "SEMICOLON"
 	case LPAREN:
@@ -403,6 +1430,8 @@ func (t TokenType) String() string {
 		return "RSQUARE"
 	case COMMA:
 		return "COMMA"
+	case COLON:
+		return "COLON"
 	case ELSE:
 		return "ELSE"
 	case FALSE:
@@ -422,14 +1451,34 @@ func (t TokenType) String() string {
 	}
 }
 
-// Token represents a single token in a Monkey language script.
+// Token represents a single token in a Monkey language script. A token
+// spans the source from its start position (Line, Col, Offset) up to but
+// not including its end position (EndLine, EndCol, EndOffset). Offsets are
+// 0-based byte offsets; lines and columns are 1-based.
 type Token struct {
-	Type   TokenType
-	File   string
-	Line   int
-	Col    int
-	String string
-	Int    int
+	Type      TokenType
+	File      string
+	Line      int
+	Col       int
+	Offset    int
+	EndLine   int
+	EndCol    int
+	EndOffset int
+	String    string
+	Int       int
+	Big       *big.Int // set instead of Int if the value doesn't fit in an int
+	Float     float64
+
+	// Set in ScanTrivia mode only.
+	Text     string   // source text of the token
+	Leading  []Trivia // trivia before the token
+	Trailing []Trivia // trivia after the token, up to the end of its line
+}
+
+// Trivia is whitespace or a comment attached to a token in ScanTrivia mode.
+type Trivia struct {
+	Comment bool // true for a comment, false for whitespace
+	Text    string
 }
 
 // NewToken returns a new Token with only the String value set.
@@ -461,9 +1510,41 @@ func NewIntToken(filename string, line, col int, s string) (*Token, error) {
 	}, nil
 }
 
+// FullText returns the token's source text including its leading and
+// trailing trivia. Concatenating the full text of every token, up to and
+// including EOF, reproduces the input exactly. It's only meaningful in
+// ScanTrivia mode.
+func (t *Token) FullText() string {
+	var sb strings.Builder
+	for _, tr := range t.Leading {
+		sb.WriteString(tr.Text)
+	}
+	sb.WriteString(t.Text)
+	for _, tr := range t.Trailing {
+		sb.WriteString(tr.Text)
+	}
+	return sb.String()
+}
+
 // EOF returns true if the token is an EOF token.
 func (t *Token) EOF() bool { return t.Type == EOF }
 
+// Pos returns the position of the first character of the token.
+func (t *Token) Pos() Pos { return Pos{Offset: t.Offset, Line: t.Line, Col: t.Col} }
+
+// End returns the position immediately after the token.
+func (t *Token) End() Pos { return Pos{Offset: t.EndOffset, Line: t.EndLine, Col: t.EndCol} }
+
+// Pos is a position in a Monkey language script.
+type Pos struct {
+	Offset int // 0-based byte offset
+	Line   int // 1-based line number
+	Col    int // 1-based column number, in runes
+}
+
+// String returns a string representation of the position.
+func (p Pos) String() string { return fmt.Sprintf("%d:%d", p.Line, p.Col) }
+
 // Error represents a lexer error.
 type Error struct {
 	Err  error
@@ -477,24 +1558,86 @@ func (e *Error) Error() string {
 	return fmt.Sprintf("%s|%d col %d| %s", e.File, e.Line, e.Col, e.Err)
 }
 
-// isLetter returns true if the rune is a valid identifier character.
+// isLetter returns true if the rune can begin an identifier.
 func isLetter(r rune) bool {
 	return 'a' <= r && r <= 'z' || 'A' <= r && r <= 'Z' || r == '_' || r >= utf8.RuneSelf && unicode.IsLetter(r)
 }
 
-// isDigit returns true if the rune is a valid numeric digit.
+// isASCIIIdent returns true if the byte is an ASCII letter, digit or '_'.
+func isASCIIIdent(c byte) bool {
+	return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' || c == '_'
+}
+
+// isASCIIDigitSep returns true if the byte is an ASCII digit or '_'.
+func isASCIIDigitSep(c byte) bool {
+	return '0' <= c && c <= '9' || c == '_'
+}
+
+// isDigit returns true if the rune is a Unicode decimal digit. Only ASCII
+// digits are valid in number literals, but others are read as part of a
+// literal so that they're reported as invalid digits.
 func isDigit(r rune) bool {
 	return '0' <= r && r <= '9' || r >= utf8.RuneSelf && unicode.IsDigit(r)
 }
 
+// truncate shortens s to at most n runes, marking truncation with "...".
+func truncate(s string, n int) string {
+	if rs := []rune(s); len(rs) > n {
+		return string(rs[:n]) + "..."
+	}
+	return s
+}
+
+// badSeparator returns the index, in runes, of the first '_' in the number
+// literal lit that isn't between two digits or -1 if all separators are
+// valid. A base prefix ending at index start counts as a digit, e.g.,
+// "0x_ff" is valid.
+func badSeparator(lit string, start int, digit func(rune) bool) int {
+	var prev rune
+	n := 0
+	for i, r := range lit {
+		if r == '_' {
+			next, _ := utf8.DecodeRuneInString(lit[i+1:])
+			prevOK := n == start || n > 0 && digit(prev)
+			nextOK := i+1 < len(lit) && digit(next)
+			if !prevOK || !nextOK {
+				return n
+			}
+		}
+		prev = r
+		n++
+	}
+	return -1
+}
+
+// hexVal returns the value of a hexadecimal digit or -1 if the rune isn't
+// a hexadecimal digit.
+func hexVal(r rune) int {
+	switch {
+	case '0' <= r && r <= '9':
+		return int(r - '0')
+	case 'a' <= r && r <= 'f':
+		return int(r - 'a' + 10)
+	case 'A' <= r && r <= 'F':
+		return int(r - 'A' + 10)
+	}
+	return -1
+}
+
 // runeTokenTypes maps single runes to a TokenType
 var runeTokenTypes = []TokenType{
 	'+': ADD,
 	'-': SUB,
 	'*': MUL,
 	'/': DIV,
+	'%': MOD,
+	'=': ASSIGN,
+	'!': NOT,
 	'<': LT,
 	'>': GT,
+	'&': BITAND,
+	'|': BITOR,
+	'^': XOR,
 	';': SEMICOLON,
 	'(': LPAREN,
 	')': RPAREN,
@@ -503,24 +1646,19 @@ var runeTokenTypes = []TokenType{
 	'[': LSQUARE,
 	']': RSQUARE,
 	',': COMMA,
+	':': COLON,
 }
 
-// keywords is a map of Monkey language keywords to token types.
-var keywords = map[string]TokenType{
-	"else":   ELSE,
-	"false":  FALSE,
-	"fn":     FN,
-	"if":     IF,
-	"let":    LET,
-	"return": RETURN,
-	"true":   TRUE,
-}
-
-// lookupIdentType returns the keyword token type for the identifier or IDENT
-// if the identifier isn't a Monkey language keyword.
-func lookupIdentType(ident string) TokenType {
-	if tokType, ok := keywords[ident]; ok {
-		return tokType
-	}
-	return IDENT
+// twoRuneTokenTypes is a map of two-rune operators to token types. Each
+// operator's first rune must also appear in runeTokenTypes, and its second
+// rune must be either '=' or the same as the first.
+var twoRuneTokenTypes = map[[2]rune]TokenType{
+	{'=', '='}: EQ,
+	{'!', '='}: NEQ,
+	{'<', '='}: LTE,
+	{'>', '='}: GTE,
+	{'&', '&'}: AND,
+	{'|', '|'}: OR,
+	{'<', '<'}: SHL,
+	{'>', '>'}: SHR,
 }
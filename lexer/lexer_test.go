@@ -1,9 +1,14 @@
 package lexer_test
 
 import (
+	"context"
+	"fmt"
 	"io/ioutil"
+	"math/rand"
 	"os"
+	"path/filepath"
 	"reflect"
+	"strings"
 	"testing"
 
 	"github.com/dgnorton/monkey/lexer"
@@ -19,130 +24,202 @@ func TestLexer_Next(t *testing.T) {
 
 	exp := []*lexer.Token{
 		&lexer.Token{
-			Type:   lexer.LET,
-			File:   file,
-			Line:   1,
-			Col:    1,
-			String: "let",
+			Type:      lexer.LET,
+			File:      file,
+			Line:      1,
+			Col:       1,
+			Offset:    0,
+			EndLine:   1,
+			EndCol:    4,
+			EndOffset: 3,
+			String:    "let",
 		},
 		&lexer.Token{
-			Type:   lexer.IDENT,
-			File:   file,
-			Line:   1,
-			Col:    5,
-			String: "add",
+			Type:      lexer.IDENT,
+			File:      file,
+			Line:      1,
+			Col:       5,
+			Offset:    4,
+			EndLine:   1,
+			EndCol:    8,
+			EndOffset: 7,
+			String:    "add",
 		},
 		&lexer.Token{
-			Type:   lexer.ASSIGN,
-			File:   file,
-			Line:   1,
-			Col:    9,
-			String: "=",
+			Type:      lexer.ASSIGN,
+			File:      file,
+			Line:      1,
+			Col:       9,
+			Offset:    8,
+			EndLine:   1,
+			EndCol:    10,
+			EndOffset: 9,
+			String:    "=",
 		},
 		&lexer.Token{
-			Type:   lexer.FN,
-			File:   file,
-			Line:   1,
-			Col:    11,
-			String: "fn",
+			Type:      lexer.FN,
+			File:      file,
+			Line:      1,
+			Col:       11,
+			Offset:    10,
+			EndLine:   1,
+			EndCol:    13,
+			EndOffset: 12,
+			String:    "fn",
 		},
 		&lexer.Token{
-			Type:   lexer.LPAREN,
-			File:   file,
-			Line:   1,
-			Col:    13,
-			String: "(",
+			Type:      lexer.LPAREN,
+			File:      file,
+			Line:      1,
+			Col:       13,
+			Offset:    12,
+			EndLine:   1,
+			EndCol:    14,
+			EndOffset: 13,
+			String:    "(",
 		},
 		&lexer.Token{
-			Type:   lexer.IDENT,
-			File:   file,
-			Line:   1,
-			Col:    14,
-			String: "丢",
+			Type:      lexer.IDENT,
+			File:      file,
+			Line:      1,
+			Col:       14,
+			Offset:    13,
+			EndLine:   1,
+			EndCol:    15,
+			EndOffset: 16,
+			String:    "丢",
 		},
 		&lexer.Token{
-			Type:   lexer.COMMA,
-			File:   file,
-			Line:   1,
-			Col:    15,
-			String: ",",
+			Type:      lexer.COMMA,
+			File:      file,
+			Line:      1,
+			Col:       15,
+			Offset:    16,
+			EndLine:   1,
+			EndCol:    16,
+			EndOffset: 17,
+			String:    ",",
 		},
 		&lexer.Token{
-			Type:   lexer.IDENT,
-			File:   file,
-			Line:   1,
-			Col:    17,
-			String: "b",
+			Type:      lexer.IDENT,
+			File:      file,
+			Line:      1,
+			Col:       17,
+			Offset:    18,
+			EndLine:   1,
+			EndCol:    18,
+			EndOffset: 19,
+			String:    "b",
 		},
 		&lexer.Token{
-			Type:   lexer.RPAREN,
-			File:   file,
-			Line:   1,
-			Col:    18,
-			String: ")",
+			Type:      lexer.RPAREN,
+			File:      file,
+			Line:      1,
+			Col:       18,
+			Offset:    19,
+			EndLine:   1,
+			EndCol:    19,
+			EndOffset: 20,
+			String:    ")",
 		},
 		&lexer.Token{
-			Type:   lexer.LBRACE,
-			File:   file,
-			Line:   1,
-			Col:    20,
-			String: "{",
+			Type:      lexer.LBRACE,
+			File:      file,
+			Line:      1,
+			Col:       20,
+			Offset:    21,
+			EndLine:   1,
+			EndCol:    21,
+			EndOffset: 22,
+			String:    "{",
 		},
 		&lexer.Token{
-			Type:   lexer.RETURN,
-			File:   file,
-			Line:   2,
-			Col:    3,
-			String: "return",
+			Type:      lexer.RETURN,
+			File:      file,
+			Line:      2,
+			Col:       3,
+			Offset:    25,
+			EndLine:   2,
+			EndCol:    9,
+			EndOffset: 31,
+			String:    "return",
 		},
 		&lexer.Token{
-			Type:   lexer.IDENT,
-			File:   file,
-			Line:   2,
-			Col:    10,
-			String: "丢",
+			Type:      lexer.IDENT,
+			File:      file,
+			Line:      2,
+			Col:       10,
+			Offset:    32,
+			EndLine:   2,
+			EndCol:    11,
+			EndOffset: 35,
+			String:    "丢",
 		},
 		&lexer.Token{
-			Type:   lexer.ADD,
-			File:   file,
-			Line:   2,
-			Col:    12,
-			String: "+",
+			Type:      lexer.ADD,
+			File:      file,
+			Line:      2,
+			Col:       12,
+			Offset:    36,
+			EndLine:   2,
+			EndCol:    13,
+			EndOffset: 37,
+			String:    "+",
 		},
 		&lexer.Token{
-			Type:   lexer.IDENT,
-			File:   file,
-			Line:   2,
-			Col:    14,
-			String: "b",
+			Type:      lexer.IDENT,
+			File:      file,
+			Line:      2,
+			Col:       14,
+			Offset:    38,
+			EndLine:   2,
+			EndCol:    15,
+			EndOffset: 39,
+			String:    "b",
 		},
 		&lexer.Token{
-			Type:   lexer.SEMICOLON,
-			File:   file,
-			Line:   2,
-			Col:    15,
-			String: ";",
+			Type:      lexer.SEMICOLON,
+			File:      file,
+			Line:      2,
+			Col:       15,
+			Offset:    39,
+			EndLine:   2,
+			EndCol:    16,
+			EndOffset: 40,
+			String:    ";",
 		},
 		&lexer.Token{
-			Type:   lexer.RBRACE,
-			File:   file,
-			Line:   3,
-			Col:    1,
-			String: "}",
+			Type:      lexer.RBRACE,
+			File:      file,
+			Line:      3,
+			Col:       1,
+			Offset:    41,
+			EndLine:   3,
+			EndCol:    2,
+			EndOffset: 42,
+			String:    "}",
 		},
 		&lexer.Token{
-			Type:   lexer.SEMICOLON,
-			File:   file,
-			Line:   3,
-			Col:    2,
-			String: ";",
+			Type:      lexer.SEMICOLON,
+			File:      file,
+			Line:      3,
+			Col:       2,
+			Offset:    42,
+			EndLine:   3,
+			EndCol:    3,
+			EndOffset: 43,
+			String:    ";",
 		},
 		&lexer.Token{
-			Type:   lexer.EOF,
-			File:   file,
-			Line:   3,
-			Col:    2,
-			String: "",
+			Type:      lexer.EOF,
+			File:      file,
+			Line:      3,
+			Col:       3,
+			Offset:    43,
+			EndLine:   3,
+			EndCol:    3,
+			EndOffset: 43,
+			String:    "",
 		},
 	}
 
@@ -175,27 +252,39 @@ func TestLexer_Peek(t *testing.T) {
 	defer os.RemoveAll(dir)
 
 	tok1 := &lexer.Token{
-		Type:   lexer.LET,
-		File:   file,
-		Line:   1,
-		Col:    1,
-		String: "let",
+		Type:      lexer.LET,
+		File:      file,
+		Line:      1,
+		Col:       1,
+		Offset:    0,
+		EndLine:   1,
+		EndCol:    4,
+		EndOffset: 3,
+		String:    "let",
 	}
 
 	tok2 := &lexer.Token{
-		Type:   lexer.IDENT,
-		File:   file,
-		Line:   1,
-		Col:    5,
-		String: "add",
+		Type:      lexer.IDENT,
+		File:      file,
+		Line:      1,
+		Col:       5,
+		Offset:    4,
+		EndLine:   1,
+		EndCol:    8,
+		EndOffset: 7,
+		String:    "add",
 	}
 
 	tok3 := &lexer.Token{
-		Type:   lexer.EOF,
-		File:   file,
-		Line:   1,
-		Col:    7,
-		String: "",
+		Type:      lexer.EOF,
+		File:      file,
+		Line:      1,
+		Col:       8,
+		Offset:    7,
+		EndLine:   1,
+		EndCol:    8,
+		EndOffset: 7,
+		String:    "",
 	}
 
 	lex, err := lexer.Open(file)
@@ -266,89 +355,226 @@ func TestLexer_Peek(t *testing.T) {
 	}
 }
 
+func TestLexer_PeekN(t *testing.T) {
+	lex := lexer.NewBytes("", []byte("a b @ c d"))
+
+	mustPeekN := func(n int, exp string) {
+		t.Helper()
+		tok, err := lex.PeekN(n)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tok.String != exp {
+			t.Fatalf("PeekN(%d): exp %q, got %q", n, exp, tok.String)
+		}
+	}
+
+	mustPeekN(2, "b")
+	mustPeekN(1, "a")
+
+	// The error is returned once, then lookahead continues past it.
+	if _, err := lex.PeekN(3); err == nil {
+		t.Fatal("expected error")
+	}
+	mustPeekN(3, "c")
+	mustPeekN(10, "")
+
+	for _, exp := range []string{"a", "b", "c", "d", ""} {
+		tok, err := lex.Scan()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tok.String != exp {
+			t.Fatalf("exp %q, got %q", exp, tok.String)
+		}
+	}
+
+	// Lookahead grows as needed.
+	lex = lexer.NewBytes("", []byte(strings.Repeat("x ", 99)+"y"))
+	mustPeekN(100, "y")
+	for i := 0; i < 99; i++ {
+		if tok, _ := lex.Next(); tok.String != "x" {
+			t.Fatalf("token %d: exp x, got %q", i, tok.String)
+		}
+	}
+	mustPeekN(1, "y")
+}
+
+func TestLexer_Mark(t *testing.T) {
+	lex := lexer.NewBytes("", []byte("a b c d e f"))
+
+	next := func() string {
+		t.Helper()
+		tok, err := lex.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return tok.String
+	}
+
+	next()
+	outer := lex.Mark()
+	next()
+	inner := lex.Mark()
+	next()
+	next()
+
+	lex.Reset(inner)
+	if got := next(); got != "c" {
+		t.Fatalf("after reset to inner mark: exp c, got %q", got)
+	}
+
+	lex.Reset(outer)
+	if got := next(); got != "b" {
+		t.Fatalf("after reset to outer mark: exp b, got %q", got)
+	}
+
+	m := lex.Mark()
+	next()
+	lex.Release(m)
+	if got := next(); got != "d" {
+		t.Fatalf("after release: exp d, got %q", got)
+	}
+
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Fatal("expected panic releasing marks out of order")
+			}
+		}()
+		m1, _ := lex.Mark(), next()
+		lex.Mark()
+		lex.Release(m1)
+	}()
+}
+
 func TestLexer_Operators(t *testing.T) {
-	code := `=+-*/!<>==!=`
+	code := `=+-*/!<>!===`
 
 	dir, file := mustWriteTempFile("", code, t)
 	defer os.RemoveAll(dir)
 
 	exps := []*lexer.Token{
 		&lexer.Token{
-			Type:   lexer.ASSIGN,
-			File:   file,
-			Line:   1,
-			Col:    1,
-			String: "=",
+			Type:      lexer.ASSIGN,
+			File:      file,
+			Line:      1,
+			Col:       1,
+			Offset:    0,
+			EndLine:   1,
+			EndCol:    2,
+			EndOffset: 1,
+			String:    "=",
 		},
 		&lexer.Token{
-			Type:   lexer.ADD,
-			File:   file,
-			Line:   1,
-			Col:    2,
-			String: "+",
+			Type:      lexer.ADD,
+			File:      file,
+			Line:      1,
+			Col:       2,
+			Offset:    1,
+			EndLine:   1,
+			EndCol:    3,
+			EndOffset: 2,
+			String:    "+",
 		},
 		&lexer.Token{
-			Type:   lexer.SUB,
-			File:   file,
-			Line:   1,
-			Col:    3,
-			String: "-",
+			Type:      lexer.SUB,
+			File:      file,
+			Line:      1,
+			Col:       3,
+			Offset:    2,
+			EndLine:   1,
+			EndCol:    4,
+			EndOffset: 3,
+			String:    "-",
 		},
 		&lexer.Token{
-			Type:   lexer.MUL,
-			File:   file,
-			Line:   1,
-			Col:    4,
-			String: "*",
+			Type:      lexer.MUL,
+			File:      file,
+			Line:      1,
+			Col:       4,
+			Offset:    3,
+			EndLine:   1,
+			EndCol:    5,
+			EndOffset: 4,
+			String:    "*",
 		},
 		&lexer.Token{
-			Type:   lexer.DIV,
-			File:   file,
-			Line:   1,
-			Col:    5,
-			String: "/",
+			Type:      lexer.DIV,
+			File:      file,
+			Line:      1,
+			Col:       5,
+			Offset:    4,
+			EndLine:   1,
+			EndCol:    6,
+			EndOffset: 5,
+			String:    "/",
 		},
 		&lexer.Token{
-			Type:   lexer.NOT,
-			File:   file,
-			Line:   1,
-			Col:    6,
-			String: "!",
+			Type:      lexer.NOT,
+			File:      file,
+			Line:      1,
+			Col:       6,
+			Offset:    5,
+			EndLine:   1,
+			EndCol:    7,
+			EndOffset: 6,
+			String:    "!",
 		},
 		&lexer.Token{
-			Type:   lexer.LT,
-			File:   file,
-			Line:   1,
-			Col:    7,
-			String: "<",
+			Type:      lexer.LT,
+			File:      file,
+			Line:      1,
+			Col:       7,
+			Offset:    6,
+			EndLine:   1,
+			EndCol:    8,
+			EndOffset: 7,
+			String:    "<",
 		},
 		&lexer.Token{
-			Type:   lexer.GT,
-			File:   file,
-			Line:   1,
-			Col:    8,
-			String: ">",
+			Type:      lexer.GT,
+			File:      file,
+			Line:      1,
+			Col:       8,
+			Offset:    7,
+			EndLine:   1,
+			EndCol:    9,
+			EndOffset: 8,
+			String:    ">",
 		},
 		&lexer.Token{
-			Type:   lexer.EQ,
-			File:   file,
-			Line:   1,
-			Col:    9,
-			String: "==",
+			Type:      lexer.NEQ,
+			File:      file,
+			Line:      1,
+			Col:       9,
+			Offset:    8,
+			EndLine:   1,
+			EndCol:    11,
+			EndOffset: 10,
+			String:    "!=",
 		},
 		&lexer.Token{
-			Type:   lexer.NEQ,
-			File:   file,
-			Line:   1,
-			Col:    11,
-			String: "!=",
+			Type:      lexer.EQ,
+			File:      file,
+			Line:      1,
+			Col:       11,
+			Offset:    10,
+			EndLine:   1,
+			EndCol:    13,
+			EndOffset: 12,
+			String:    "==",
 		},
 		&lexer.Token{
-			Type:   lexer.EOF,
-			File:   file,
-			Line:   1,
-			Col:    12,
-			String: "",
+			Type:      lexer.EOF,
+			File:      file,
+			Line:      1,
+			Col:       13,
+			Offset:    12,
+			EndLine:   1,
+			EndCol:    13,
+			EndOffset: 12,
+			String:    "",
 		},
 	}
 
@@ -378,6 +604,43 @@ func TestLexer_Operators(t *testing.T) {
 	}
 }
 
+func TestLexer_CompoundOperators(t *testing.T) {
+	code := "a<=b >= c&&d||e % f & g|h ^ i<<j>>k < =!"
+
+	exps := []tokPos{
+		{lexer.IDENT, 1, 1, "a"},
+		{lexer.LTE, 1, 2, "<="},
+		{lexer.IDENT, 1, 4, "b"},
+		{lexer.GTE, 1, 6, ">="},
+		{lexer.IDENT, 1, 9, "c"},
+		{lexer.AND, 1, 10, "&&"},
+		{lexer.IDENT, 1, 12, "d"},
+		{lexer.OR, 1, 13, "||"},
+		{lexer.IDENT, 1, 15, "e"},
+		{lexer.MOD, 1, 17, "%"},
+		{lexer.IDENT, 1, 19, "f"},
+		{lexer.BITAND, 1, 21, "&"},
+		{lexer.IDENT, 1, 23, "g"},
+		{lexer.BITOR, 1, 24, "|"},
+		{lexer.IDENT, 1, 25, "h"},
+		{lexer.XOR, 1, 27, "^"},
+		{lexer.IDENT, 1, 29, "i"},
+		{lexer.SHL, 1, 30, "<<"},
+		{lexer.IDENT, 1, 32, "j"},
+		{lexer.SHR, 1, 33, ">>"},
+		{lexer.IDENT, 1, 35, "k"},
+		{lexer.LT, 1, 37, "<"},
+		{lexer.ASSIGN, 1, 39, "="},
+		{lexer.NOT, 1, 40, "!"},
+		{lexer.EOF, 1, 41, ""},
+	}
+
+	lex := lexer.New("", strings.NewReader(code))
+	if got := mustLexPos(lex, t); !reflect.DeepEqual(exps, got) {
+		t.Fatalf("tokens don't match:\nexp: %v\ngot: %v", exps, got)
+	}
+}
+
 func TestLexer_Keywords(t *testing.T) {
 	code := `fn let true false if else return`
 
@@ -386,60 +649,92 @@ func TestLexer_Keywords(t *testing.T) {
 
 	exps := []*lexer.Token{
 		&lexer.Token{
-			Type:   lexer.FN,
-			File:   file,
-			Line:   1,
-			Col:    1,
-			String: "fn",
+			Type:      lexer.FN,
+			File:      file,
+			Line:      1,
+			Col:       1,
+			Offset:    0,
+			EndLine:   1,
+			EndCol:    3,
+			EndOffset: 2,
+			String:    "fn",
 		},
 		&lexer.Token{
-			Type:   lexer.LET,
-			File:   file,
-			Line:   1,
-			Col:    4,
-			String: "let",
+			Type:      lexer.LET,
+			File:      file,
+			Line:      1,
+			Col:       4,
+			Offset:    3,
+			EndLine:   1,
+			EndCol:    7,
+			EndOffset: 6,
+			String:    "let",
 		},
 		&lexer.Token{
-			Type:   lexer.TRUE,
-			File:   file,
-			Line:   1,
-			Col:    8,
-			String: "true",
+			Type:      lexer.TRUE,
+			File:      file,
+			Line:      1,
+			Col:       8,
+			Offset:    7,
+			EndLine:   1,
+			EndCol:    12,
+			EndOffset: 11,
+			String:    "true",
 		},
 		&lexer.Token{
-			Type:   lexer.FALSE,
-			File:   file,
-			Line:   1,
-			Col:    13,
-			String: "false",
+			Type:      lexer.FALSE,
+			File:      file,
+			Line:      1,
+			Col:       13,
+			Offset:    12,
+			EndLine:   1,
+			EndCol:    18,
+			EndOffset: 17,
+			String:    "false",
 		},
 		&lexer.Token{
-			Type:   lexer.IF,
-			File:   file,
-			Line:   1,
-			Col:    19,
-			String: "if",
+			Type:      lexer.IF,
+			File:      file,
+			Line:      1,
+			Col:       19,
+			Offset:    18,
+			EndLine:   1,
+			EndCol:    21,
+			EndOffset: 20,
+			String:    "if",
 		},
 		&lexer.Token{
-			Type:   lexer.ELSE,
-			File:   file,
-			Line:   1,
-			Col:    22,
-			String: "else",
+			Type:      lexer.ELSE,
+			File:      file,
+			Line:      1,
+			Col:       22,
+			Offset:    21,
+			EndLine:   1,
+			EndCol:    26,
+			EndOffset: 25,
+			String:    "else",
 		},
 		&lexer.Token{
-			Type:   lexer.RETURN,
-			File:   file,
-			Line:   1,
-			Col:    27,
-			String: "return",
+			Type:      lexer.RETURN,
+			File:      file,
+			Line:      1,
+			Col:       27,
+			Offset:    26,
+			EndLine:   1,
+			EndCol:    33,
+			EndOffset: 32,
+			String:    "return",
 		},
 		&lexer.Token{
-			Type:   lexer.EOF,
-			File:   file,
-			Line:   1,
-			Col:    32,
-			String: "",
+			Type:      lexer.EOF,
+			File:      file,
+			Line:      1,
+			Col:       33,
+			Offset:    32,
+			EndLine:   1,
+			EndCol:    33,
+			EndOffset: 32,
+			String:    "",
 		},
 	}
 
@@ -469,6 +764,1044 @@ func TestLexer_Keywords(t *testing.T) {
 	}
 }
 
+func TestLexer_Strings(t *testing.T) {
+	code := `"hello" "a\tb\n" "say \"hi\"" "\\" "\u{1F600}\u{e9}" "two
+lines" x`
+
+	exps := []*lexer.Token{
+		&lexer.Token{Type: lexer.STRING, Line: 1, Col: 1, Offset: 0, EndLine: 1, EndCol: 8, EndOffset: 7, String: "hello"},
+		&lexer.Token{Type: lexer.STRING, Line: 1, Col: 9, Offset: 8, EndLine: 1, EndCol: 17, EndOffset: 16, String: "a\tb\n"},
+		&lexer.Token{Type: lexer.STRING, Line: 1, Col: 18, Offset: 17, EndLine: 1, EndCol: 30, EndOffset: 29, String: `say "hi"`},
+		&lexer.Token{Type: lexer.STRING, Line: 1, Col: 31, Offset: 30, EndLine: 1, EndCol: 35, EndOffset: 34, String: `\`},
+		&lexer.Token{Type: lexer.STRING, Line: 1, Col: 36, Offset: 35, EndLine: 1, EndCol: 53, EndOffset: 52, String: "\U0001F600\u00e9"},
+		&lexer.Token{Type: lexer.STRING, Line: 1, Col: 54, Offset: 53, EndLine: 2, EndCol: 7, EndOffset: 64, String: "two\nlines"},
+		&lexer.Token{Type: lexer.IDENT, Line: 2, Col: 8, Offset: 65, EndLine: 2, EndCol: 9, EndOffset: 66, String: "x"},
+		&lexer.Token{Type: lexer.EOF, Line: 2, Col: 9, Offset: 66, EndLine: 2, EndCol: 9, EndOffset: 66, String: ""},
+	}
+
+	lex := lexer.New("", strings.NewReader(code))
+
+	for i := 0; ; i++ {
+		got, err := lex.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !reflect.DeepEqual(exps[i], got) {
+			t.Fatalf("tokens don't match:\nexp: %v\ngot: %v", exps[i], got)
+		}
+
+		if got.EOF() {
+			break
+		}
+	}
+}
+
+func TestLexer_StringErrors(t *testing.T) {
+	tests := []struct {
+		code string
+		exp  string
+	}{
+		{`x = "abc`, "|1 col 5| unterminated string"},
+		{`"a\qb"`, `|1 col 3| invalid escape sequence: \q`},
+		{`"\u{}"`, "|1 col 2| invalid unicode escape sequence"},
+		{`"\u0041"`, "|1 col 2| invalid unicode escape sequence"},
+		{`"\u{110000}"`, "|1 col 2| invalid unicode escape sequence"},
+		{`"\u{D800}"`, "|1 col 2| invalid unicode escape sequence"},
+	}
+
+	for _, test := range tests {
+		lex := lexer.New("", strings.NewReader(test.code))
+
+		var err error
+		for {
+			var tok *lexer.Token
+			if tok, err = lex.Next(); err != nil || tok.EOF() {
+				break
+			}
+		}
+
+		if err == nil {
+			t.Fatalf("%s: expected error", test.code)
+		}
+
+		if got := err.Error(); got != test.exp {
+			t.Fatalf("%s:\nexp: %s\ngot: %s", test.code, test.exp, got)
+		}
+	}
+}
+
+func TestLexer_Templates(t *testing.T) {
+	code := "`a${x}b${ {1: `c${y}`}[1] }d` `\\` \\${}` `\n`"
+
+	exps := []tokPos{
+		{lexer.TEMPLATE_HEAD, 1, 1, "a"},
+		{lexer.IDENT, 1, 5, "x"},
+		{lexer.TEMPLATE_MIDDLE, 1, 6, "b"},
+		{lexer.LBRACE, 1, 11, "{"},
+		{lexer.INT, 1, 12, "1"},
+		{lexer.COLON, 1, 13, ":"},
+		{lexer.TEMPLATE_HEAD, 1, 15, "c"},
+		{lexer.IDENT, 1, 19, "y"},
+		{lexer.TEMPLATE_TAIL, 1, 20, ""},
+		{lexer.RBRACE, 1, 22, "}"},
+		{lexer.LSQUARE, 1, 23, "["},
+		{lexer.INT, 1, 24, "1"},
+		{lexer.RSQUARE, 1, 25, "]"},
+		{lexer.TEMPLATE_TAIL, 1, 27, "d"},
+		{lexer.TEMPLATE, 1, 31, "` ${}"},
+		{lexer.TEMPLATE, 1, 41, "\n"},
+		{lexer.EOF, 2, 2, ""},
+	}
+
+	lex := lexer.New("", strings.NewReader(code))
+	if got := mustLexPos(lex, t); !reflect.DeepEqual(exps, got) {
+		t.Fatalf("tokens don't match:\nexp: %v\ngot: %v", exps, got)
+	}
+}
+
+func TestLexer_TemplateErrors(t *testing.T) {
+	tests := []struct {
+		code string
+		exp  string
+	}{
+		{"`abc", "|1 col 1| unterminated template literal"},
+		{"`a${b}c", "|1 col 6| unterminated template literal"},
+		{"`a\\qb`", "|1 col 3| invalid escape sequence: \\q"},
+	}
+
+	for _, test := range tests {
+		lex := lexer.New("", strings.NewReader(test.code))
+
+		var err error
+		for err == nil {
+			var tok *lexer.Token
+			if tok, err = lex.Next(); err == nil && tok.EOF() {
+				break
+			}
+		}
+
+		if err == nil || err.Error() != test.exp {
+			t.Fatalf("%q:\nexp: %s\ngot: %v", test.code, test.exp, err)
+		}
+	}
+}
+
+func TestLexer_Comments(t *testing.T) {
+	code := `// header
+let x = 1; // trailing
+/* block
+   /* nested */ */ x / 2 /**/`
+
+	exps := []tokPos{
+		{lexer.COMMENT, 1, 1, "// header"},
+		{lexer.LET, 2, 1, "let"},
+		{lexer.IDENT, 2, 5, "x"},
+		{lexer.ASSIGN, 2, 7, "="},
+		{lexer.INT, 2, 9, "1"},
+		{lexer.SEMICOLON, 2, 10, ";"},
+		{lexer.COMMENT, 2, 12, "// trailing"},
+		{lexer.COMMENT, 3, 1, "/* block\n   /* nested */ */"},
+		{lexer.IDENT, 4, 20, "x"},
+		{lexer.DIV, 4, 22, "/"},
+		{lexer.INT, 4, 24, "2"},
+		{lexer.COMMENT, 4, 26, "/**/"},
+		{lexer.EOF, 4, 30, ""},
+	}
+
+	// Comments are skipped by default.
+	var skipped []tokPos
+	for _, exp := range exps {
+		if exp.Type != lexer.COMMENT {
+			skipped = append(skipped, exp)
+		}
+	}
+
+	lex := lexer.New("", strings.NewReader(code))
+	if got := mustLexPos(lex, t); !reflect.DeepEqual(skipped, got) {
+		t.Fatalf("tokens don't match:\nexp: %v\ngot: %v", skipped, got)
+	}
+
+	lex = lexer.New("", strings.NewReader(code))
+	lex.SetMode(lexer.ScanComments)
+	if got := mustLexPos(lex, t); !reflect.DeepEqual(exps, got) {
+		t.Fatalf("tokens don't match:\nexp: %v\ngot: %v", exps, got)
+	}
+}
+
+func TestLexer_CommentErrors(t *testing.T) {
+	code := "x /* a /* b */\n c"
+
+	lex := lexer.New("", strings.NewReader(code))
+	lex.Next()
+
+	_, err := lex.Next()
+	if err == nil {
+		t.Fatal("expected error")
+	}
+
+	if exp := "|1 col 3| unterminated comment"; err.Error() != exp {
+		t.Fatalf("\nexp: %s\ngot: %s", exp, err)
+	}
+}
+
+func TestLexer_RecoverErrors(t *testing.T) {
+	code := `let x = @ 1e + 0b12;
+"a\qb" # y
+"open`
+
+	exps := []tokPos{
+		{lexer.LET, 1, 1, "let"},
+		{lexer.IDENT, 1, 5, "x"},
+		{lexer.ASSIGN, 1, 7, "="},
+		{lexer.ILLEGAL, 1, 9, "@"},
+		{lexer.ILLEGAL, 1, 11, "1e"},
+		{lexer.ADD, 1, 14, "+"},
+		{lexer.ILLEGAL, 1, 16, "0b12"},
+		{lexer.SEMICOLON, 1, 20, ";"},
+		{lexer.ILLEGAL, 2, 1, `"a\qb"`},
+		{lexer.ILLEGAL, 2, 8, "#"},
+		{lexer.IDENT, 2, 10, "y"},
+		{lexer.ILLEGAL, 3, 1, `"open`},
+		{lexer.EOF, 3, 6, ""},
+	}
+
+	expErrs := []string{
+		"|1 col 9| invalid token: @",
+		"|1 col 13| exponent has no digits",
+		"|1 col 19| invalid digit '2' in binary literal",
+		"|2 col 3| invalid escape sequence: \\q",
+		"|2 col 8| invalid token: #",
+		"|3 col 1| unterminated string",
+	}
+
+	lex := lexer.New("", strings.NewReader(code))
+	lex.SetMode(lexer.RecoverErrors)
+	if got := mustLexPos(lex, t); !reflect.DeepEqual(exps, got) {
+		t.Fatalf("tokens don't match:\nexp: %v\ngot: %v", exps, got)
+	}
+
+	var gotErrs []string
+	for _, err := range lex.Errors() {
+		gotErrs = append(gotErrs, err.Error())
+	}
+
+	if !reflect.DeepEqual(expErrs, gotErrs) {
+		t.Fatalf("errors don't match:\nexp: %q\ngot: %q", expErrs, gotErrs)
+	}
+
+	// Without RecoverErrors, the first error is returned.
+	lex = lexer.New("", strings.NewReader(code))
+	for i := 0; i < 3; i++ {
+		lex.Next()
+	}
+	if _, err := lex.Next(); err == nil || err.Error() != expErrs[0] {
+		t.Fatalf("\nexp: %s\ngot: %v", expErrs[0], err)
+	}
+}
+
+func TestLexer_Config(t *testing.T) {
+	cfg := lexer.DefaultConfig()
+	cfg.Keywords["and"] = lexer.AND
+	delete(cfg.Keywords, "fn")
+	delete(cfg.Operators, lexer.SHL)
+	cfg.UnicodeIdents = false
+
+	code := "a and fn << b < c héllo"
+
+	exps := []tokPos{
+		{lexer.IDENT, 1, 1, "a"},
+		{lexer.AND, 1, 3, "and"},
+		{lexer.IDENT, 1, 7, "fn"},
+		{lexer.ILLEGAL, 1, 10, "<<"},
+		{lexer.IDENT, 1, 13, "b"},
+		{lexer.LT, 1, 15, "<"},
+		{lexer.IDENT, 1, 17, "c"},
+		{lexer.ILLEGAL, 1, 19, "héllo"},
+		{lexer.EOF, 1, 24, ""},
+	}
+
+	expErrs := []string{
+		"|1 col 10| invalid token: <<",
+		"|1 col 19| non-ASCII identifier: héllo",
+	}
+
+	for _, lex := range []*lexer.Lexer{
+		lexer.New("", strings.NewReader(code), cfg),
+		lexer.NewBytes("", []byte(code), cfg),
+	} {
+		lex.SetMode(lexer.RecoverErrors)
+		if got := mustLexPos(lex, t); !reflect.DeepEqual(exps, got) {
+			t.Fatalf("tokens don't match:\nexp: %v\ngot: %v", exps, got)
+		}
+
+		var gotErrs []string
+		for _, err := range lex.Errors() {
+			gotErrs = append(gotErrs, err.Error())
+		}
+
+		if !reflect.DeepEqual(expErrs, gotErrs) {
+			t.Fatalf("errors don't match:\nexp: %q\ngot: %q", expErrs, gotErrs)
+		}
+	}
+
+	// The default configuration is unaffected.
+	if got := mustLexPos(lexer.New("", strings.NewReader("fn héllo")), t); got[0].Type != lexer.FN || got[1].Type != lexer.IDENT {
+		t.Fatalf("unexpected tokens: %v", got)
+	}
+}
+
+func TestLexer_ExpressionConfig(t *testing.T) {
+	lex := lexer.NewBytes("", []byte("if (let > 1) { return } x = 1"), lexer.ExpressionConfig())
+	lex.SetMode(lexer.RecoverErrors)
+
+	var types []lexer.TokenType
+	for _, tok := range mustLexPos(lex, t) {
+		types = append(types, tok.Type)
+	}
+
+	exp := []lexer.TokenType{
+		lexer.IF, lexer.LPAREN, lexer.IDENT, lexer.GT, lexer.INT, lexer.RPAREN,
+		lexer.LBRACE, lexer.IDENT, lexer.RBRACE,
+		lexer.IDENT, lexer.ILLEGAL, lexer.INT, lexer.EOF,
+	}
+	if !reflect.DeepEqual(exp, types) {
+		t.Fatalf("\nexp: %v\ngot: %v", exp, types)
+	}
+}
+
+func TestLexer_UnicodeIdents(t *testing.T) {
+	// "é" precomposed and as "e" followed by a combining acute accent.
+	code := "\u00e9 e\u0301 x\u0663 a\u203fb \u4e22\u0301"
+
+	exps := []tokPos{
+		{lexer.IDENT, 1, 1, "\u00e9"},
+		{lexer.IDENT, 1, 3, "\u00e9"},
+		{lexer.IDENT, 1, 6, "x\u0663"},
+		{lexer.IDENT, 1, 9, "a\u203fb"},
+		{lexer.IDENT, 1, 13, "\u4e22\u0301"},
+		{lexer.EOF, 1, 15, ""},
+	}
+
+	for _, lex := range []*lexer.Lexer{
+		lexer.New("", strings.NewReader(code)),
+		lexer.NewBytes("", []byte(code)),
+	} {
+		if got := mustLexPos(lex, t); !reflect.DeepEqual(exps, got) {
+			t.Fatalf("tokens don't match:\nexp: %+v\ngot: %+v", exps, got)
+		}
+	}
+
+	// The source text isn't normalized.
+	lex := lexer.NewBytes("", []byte(code))
+	lex.SetMode(lexer.ScanTrivia)
+	lex.Next()
+	if tok, _ := lex.Next(); tok.String != "\u00e9" || tok.Text != "e\u0301" {
+		t.Fatalf("exp %q from %q, got %q from %q", "\u00e9", "e\u0301", tok.String, tok.Text)
+	}
+
+	// Keywords are matched after normalization.
+	cfg := lexer.DefaultConfig()
+	cfg.Keywords["caf\u00e9"] = lexer.LET
+	if tok, _ := lexer.NewBytes("", []byte("cafe\u0301"), cfg).Next(); tok.Type != lexer.LET {
+		t.Fatalf("exp LET, got %s", tok.Type)
+	}
+}
+
+func TestLexer_WarnConfusables(t *testing.T) {
+	code := "paypal p\u0430ypal \u0441\u043e\u0441\u043e \u043a\u043e\u0442 \u6f22\u5b57\u30ab\u30ca x1 \u0391\u0392\u03a9 \u0391\u0392"
+
+	exp := []string{
+		"|1 col 8| mixed-script identifier: p\u0430ypal (Cyrillic, Latin)",
+		"|1 col 15| confusable identifier: \u0441\u043e\u0441\u043e looks like coco",
+		"|1 col 36| confusable identifier: \u0391\u0392 looks like AB",
+	}
+
+	lex := lexer.NewBytes("", []byte(code))
+	lex.SetMode(lexer.WarnConfusables)
+	mustLexPos(lex, t)
+
+	var got []string
+	for _, w := range lex.Warnings() {
+		got = append(got, w.Error())
+	}
+
+	if !reflect.DeepEqual(exp, got) {
+		t.Fatalf("warnings don't match:\nexp: %q\ngot: %q", exp, got)
+	}
+
+	// Warnings are opt-in.
+	lex = lexer.NewBytes("", []byte(code))
+	if mustLexPos(lex, t); len(lex.Warnings()) != 0 {
+		t.Fatalf("unexpected warnings: %v", lex.Warnings())
+	}
+}
+
+func TestPosEncoder(t *testing.T) {
+	code := "a\tb = \"\u00e9\U0001f600\" + \u4e22\n\tx"
+
+	toks, err := lexAll(lexer.NewBytes("", []byte(code)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Start and end columns of each token.
+	tests := []struct {
+		unit     lexer.ColumnUnit
+		tabWidth int
+		exp      [][2]int
+	}{
+		{lexer.RuneColumns, 0, [][2]int{{1, 2}, {3, 4}, {5, 6}, {7, 11}, {12, 13}, {14, 15}, {2, 3}, {3, 3}}},
+		{lexer.ByteColumns, 0, [][2]int{{1, 2}, {3, 4}, {5, 6}, {7, 15}, {16, 17}, {18, 21}, {2, 3}, {3, 3}}},
+		{lexer.UTF16Columns, 0, [][2]int{{1, 2}, {3, 4}, {5, 6}, {7, 12}, {13, 14}, {15, 16}, {2, 3}, {3, 3}}},
+		{lexer.VisualColumns, 4, [][2]int{{1, 2}, {5, 6}, {7, 8}, {9, 14}, {15, 16}, {17, 19}, {5, 6}, {6, 6}}},
+		{lexer.VisualColumns, 0, [][2]int{{1, 2}, {9, 10}, {11, 12}, {13, 18}, {19, 20}, {21, 23}, {9, 10}, {10, 10}}},
+	}
+
+	for _, test := range tests {
+		enc := lexer.NewPosEncoder([]byte(code), test.unit, test.tabWidth)
+
+		var got [][2]int
+		for _, tok := range toks {
+			start, end := enc.Encode(tok.Pos()), enc.Encode(tok.End())
+			if start.Line != tok.Line || start.Offset != tok.Offset || end.Line != tok.EndLine {
+				t.Fatalf("unit %d: line or offset changed: %v", test.unit, tok)
+			}
+			got = append(got, [2]int{start.Col, end.Col})
+		}
+
+		if !reflect.DeepEqual(test.exp, got) {
+			t.Fatalf("unit %d, tab width %d:\nexp: %v\ngot: %v", test.unit, test.tabWidth, test.exp, got)
+		}
+	}
+
+	// Combining marks take no space.
+	enc := lexer.NewPosEncoder([]byte("e\u0301x"), lexer.VisualColumns, 0)
+	if got := enc.Column(1, 3); got != 2 {
+		t.Fatalf("exp column 2, got %d", got)
+	}
+}
+
+func TestLexer_Numbers(t *testing.T) {
+	tests := []struct {
+		code string
+		typ  lexer.TokenType
+		i    int
+		f    float64
+	}{
+		{"42", lexer.INT, 42, 0},
+		{"1.5", lexer.FLOAT, 0, 1.5},
+		{"1.", lexer.FLOAT, 0, 1},
+		{".25", lexer.FLOAT, 0, 0.25},
+		{"1e3", lexer.FLOAT, 0, 1e3},
+		{"1E+3", lexer.FLOAT, 0, 1e3},
+		{"1e-9", lexer.FLOAT, 0, 1e-9},
+		{"2.5e-3", lexer.FLOAT, 0, 2.5e-3},
+		{".5e1", lexer.FLOAT, 0, 5},
+		{"1_000_000", lexer.INT, 1000000, 0},
+		{"1_000.000_1", lexer.FLOAT, 0, 1000.0001},
+		{"1e1_0", lexer.FLOAT, 0, 1e10},
+		{"0x1F", lexer.INT, 31, 0},
+		{"0XdeadBEEF", lexer.INT, 0xdeadbeef, 0},
+		{"0x_ff_ff", lexer.INT, 0xffff, 0},
+		{"0o755", lexer.INT, 0755, 0},
+		{"0O1_7", lexer.INT, 15, 0},
+		{"0b1010", lexer.INT, 10, 0},
+		{"0B1111_0000", lexer.INT, 240, 0},
+		{"0", lexer.INT, 0, 0},
+		{"007", lexer.INT, 7, 0},
+		{"9223372036854775807", lexer.INT, 9223372036854775807, 0},
+	}
+
+	for _, test := range tests {
+		lex := lexer.New("", strings.NewReader(test.code))
+
+		tok, err := lex.Next()
+		if err != nil {
+			t.Fatalf("%s: %s", test.code, err)
+		}
+
+		if tok.Type != test.typ || tok.Int != test.i || tok.Float != test.f || tok.String != test.code {
+			t.Fatalf("%s: exp %s %d %g, got %s %d %g %q", test.code, test.typ, test.i, test.f, tok.Type, tok.Int, tok.Float, tok.String)
+		}
+
+		if tok, err = lex.Next(); err != nil || !tok.EOF() {
+			t.Fatalf("%s: exp EOF, got %v %v", test.code, tok, err)
+		}
+	}
+}
+
+func TestLexer_NumberErrors(t *testing.T) {
+	tests := []struct {
+		code string
+		exp  string
+	}{
+		{"x = 1e", "|1 col 7| exponent has no digits"},
+		{"1.5e+x", "|1 col 6| exponent has no digits"},
+		{"1e999", "|1 col 1| float literal out of range: 1e999"},
+		{". 5", "|1 col 1| invalid token: ."},
+		{"x = 0x", "|1 col 5| hexadecimal literal has no digits"},
+		{"0o_", "|1 col 1| octal literal has no digits"},
+		{"0b102", "|1 col 5| invalid digit '2' in binary literal"},
+		{"0o8", "|1 col 3| invalid digit '8' in octal literal"},
+		{"0xfg", "|1 col 4| invalid digit 'g' in hexadecimal literal"},
+		{"1__000", "|1 col 2| '_' must separate successive digits"},
+		{"1000_", "|1 col 5| '_' must separate successive digits"},
+		{"1_.5", "|1 col 2| '_' must separate successive digits"},
+		{"1e_5", "|1 col 3| '_' must separate successive digits"},
+		{"0xff_", "|1 col 5| '_' must separate successive digits"},
+		{"\u0663", "|1 col 1| invalid digit '\u0663' in decimal literal"},
+		{"x = 1_\u0663", "|1 col 7| invalid digit '\u0663' in decimal literal"},
+		{".5e\u0663", "|1 col 4| invalid digit '\u0663' in decimal literal"},
+		{"0x1\u0663", "|1 col 4| invalid digit '\u0663' in hexadecimal literal"},
+		{"x = " + strings.Repeat("9", 20000), "|1 col 5| integer literal out of range: 99999999999999999999..."},
+	}
+
+	for _, test := range tests {
+		lex := lexer.New("", strings.NewReader(test.code))
+
+		var err error
+		for {
+			var tok *lexer.Token
+			if tok, err = lex.Next(); err != nil || tok.EOF() {
+				break
+			}
+		}
+
+		if err == nil {
+			t.Fatalf("%s: expected error", test.code)
+		}
+
+		if got := err.Error(); got != test.exp {
+			t.Fatalf("%s:\nexp: %s\ngot: %s", test.code, test.exp, got)
+		}
+	}
+}
+
+func TestLexer_BigInts(t *testing.T) {
+	tests := []struct {
+		code string
+		exp  string
+	}{
+		{"9223372036854775808", "9223372036854775808"},
+		{"123_456_789_012_345_678_901", "123456789012345678901"},
+		{"0xffff_ffff_ffff_ffff_ffff", "1208925819614629174706175"},
+		{"0b1" + strings.Repeat("0", 64), "18446744073709551616"},
+	}
+
+	for _, test := range tests {
+		tok, err := lexer.New("", strings.NewReader(test.code)).Next()
+		if err != nil {
+			t.Fatalf("%s: %s", test.code, err)
+		}
+
+		if tok.Big == nil || tok.Int != 0 {
+			t.Fatalf("%s: exp big integer, got %v", test.code, tok)
+		}
+
+		if got := tok.Big.String(); got != test.exp {
+			t.Fatalf("%s: exp %s, got %s", test.code, test.exp, got)
+		}
+	}
+}
+
+func TestLexer_NewBytes(t *testing.T) {
+	tests := []string{
+		benchScript,
+		"let ünïcödé = \"日本\\u{8a9e}\"; // コメント\n/* a /* b */ */ x",
+		"0x_ff + 0o17 + 0b1_0 + 1_000.5e-3 + .5 + 9223372036854775808",
+		"a <= b && c >= d || !e % f & g | h ^ i << j >> k",
+		"let x = @ 1e + 0b12;\n\"a\\qb\" # y\n\"open",
+		"1__0",
+		"x /* unterminated",
+		"`a ${ {b: `c${d}`} } e` `\\${`",
+		"a \xff b /* \xfe */ \"\xc3\" \xe2\x82",
+		"",
+	}
+
+	for _, code := range tests {
+		for _, mode := range []lexer.Mode{0, lexer.ScanComments | lexer.RecoverErrors} {
+			rlex := lexer.New("f", strings.NewReader(code))
+			rlex.SetMode(mode)
+			exps, expErr := lexAll(rlex)
+
+			blex := lexer.NewBytes("f", []byte(code))
+			blex.SetMode(mode)
+			gots, gotErr := lexAll(blex)
+
+			if !reflect.DeepEqual(exps, gots) {
+				t.Fatalf("%q: tokens don't match:\nexp: %v\ngot: %v", code, exps, gots)
+			}
+
+			if !reflect.DeepEqual(expErr, gotErr) {
+				t.Fatalf("%q: errors don't match:\nexp: %v\ngot: %v", code, expErr, gotErr)
+			}
+
+			if !reflect.DeepEqual(rlex.Errors(), blex.Errors()) {
+				t.Fatalf("%q: recorded errors don't match:\nexp: %v\ngot: %v", code, rlex.Errors(), blex.Errors())
+			}
+		}
+	}
+}
+
+func TestLexer_Trivia(t *testing.T) {
+	code := "// header\n\nlet x = 1; // one\n  /* a */ x\t/* b\n */ + 2\n// end\n"
+
+	type trivTok struct {
+		Text     string
+		Leading  []lexer.Trivia
+		Trailing []lexer.Trivia
+	}
+
+	ws := func(s string) lexer.Trivia { return lexer.Trivia{Text: s} }
+	cmt := func(s string) lexer.Trivia { return lexer.Trivia{Comment: true, Text: s} }
+
+	exps := []trivTok{
+		{"let", []lexer.Trivia{cmt("// header"), ws("\n\n")}, []lexer.Trivia{ws(" ")}},
+		{"x", nil, []lexer.Trivia{ws(" ")}},
+		{"=", nil, []lexer.Trivia{ws(" ")}},
+		{"1", nil, nil},
+		{";", nil, []lexer.Trivia{ws(" "), cmt("// one")}},
+		{"x", []lexer.Trivia{ws("\n  "), cmt("/* a */"), ws(" ")}, []lexer.Trivia{ws("\t"), cmt("/* b\n */"), ws(" ")}},
+		{"+", nil, []lexer.Trivia{ws(" ")}},
+		{"2", nil, nil},
+		{"", []lexer.Trivia{ws("\n"), cmt("// end"), ws("\n")}, nil},
+	}
+
+	for _, lex := range []*lexer.Lexer{
+		lexer.New("", strings.NewReader(code)),
+		lexer.NewBytes("", []byte(code)),
+	} {
+		lex.SetMode(lexer.ScanTrivia)
+
+		toks, err := lexAll(lex)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var gots []trivTok
+		for _, tok := range toks {
+			gots = append(gots, trivTok{tok.Text, tok.Leading, tok.Trailing})
+		}
+
+		if !reflect.DeepEqual(exps, gots) {
+			t.Fatalf("trivia doesn't match:\nexp: %+v\ngot: %+v", exps, gots)
+		}
+	}
+}
+
+func TestLexer_TriviaRoundTrip(t *testing.T) {
+	tests := []string{
+		benchScript,
+		"",
+		"   \n\t ",
+		"x",
+		"a/b//c\n/**/d/ /e",
+		"let s = \"a\\n\\u{1F600}\";\r\n\u00a0x\u2003+ 1_000",
+		"/* a /* nested */ comment */ fn(x) { x }\n// trailing",
+		"let x = @ 1e + 0b12;\n\"a\\qb\" # y\n\"open",
+		"x /* unterminated",
+		"a \xff b /* \xfe */ \"\xc3\" \xe2\x82",
+	}
+
+	modes := []lexer.Mode{
+		lexer.ScanTrivia | lexer.RecoverErrors,
+		lexer.ScanTrivia | lexer.RecoverErrors | lexer.ScanComments,
+	}
+
+	for _, code := range tests {
+		for _, mode := range modes {
+			for _, lex := range []*lexer.Lexer{
+				lexer.New("", strings.NewReader(code)),
+				lexer.NewBytes("", []byte(code)),
+			} {
+				lex.SetMode(mode)
+
+				toks, err := lexAll(lex)
+				if err != nil {
+					t.Fatalf("%q: %s", code, err)
+				}
+
+				var sb strings.Builder
+				for _, tok := range toks {
+					sb.WriteString(tok.FullText())
+				}
+
+				if got := sb.String(); got != code {
+					t.Fatalf("mode %d: round trip doesn't match:\nexp: %q\ngot: %q", mode, code, got)
+				}
+			}
+		}
+	}
+}
+
+func TestLexer_ScanAllocs(t *testing.T) {
+	line := "let add = fn(a, b) { if (a >= b && b != 0) { return a % b; } a + b * 1.5 }; // c\n"
+
+	// Count the tokens in one line so each run below scans exactly one.
+	n := 0
+	for lex := lexer.NewBytes("", []byte(line)); ; n++ {
+		tok, err := lex.Scan()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tok.EOF() {
+			break
+		}
+	}
+
+	lex := lexer.NewBytes("", []byte(strings.Repeat(line, 200)))
+	allocs := testing.AllocsPerRun(100, func() {
+		for i := 0; i < n; i++ {
+			if _, err := lex.Scan(); err != nil {
+				t.Fatal(err)
+			}
+		}
+	})
+
+	if allocs != 0 {
+		t.Fatalf("exp 0 allocations per line, got %v", allocs)
+	}
+}
+
+func TestLexer_Stream(t *testing.T) {
+	exps, err := lexAll(lexer.NewBytes("", []byte(benchScript)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var gots []*lexer.Token
+	for res := range lexer.NewBytes("", []byte(benchScript)).Stream(context.Background()) {
+		if res.Err != nil {
+			t.Fatal(res.Err)
+		}
+		tok := res.Tok
+		gots = append(gots, &tok)
+	}
+
+	if !reflect.DeepEqual(exps, gots) {
+		t.Fatalf("tokens don't match:\nexp: %v\ngot: %v", exps, gots)
+	}
+
+	// Errors end the stream.
+	var last lexer.Result
+	n := 0
+	for res := range lexer.NewBytes("", []byte("x @ y")).Stream(context.Background()) {
+		last = res
+		n++
+	}
+
+	if exp := "|1 col 3| invalid token: @"; n != 2 || last.Err == nil || last.Err.Error() != exp {
+		t.Fatalf("exp error %q after 2 results, got %v after %d", exp, last.Err, n)
+	}
+}
+
+func TestLexer_StreamCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	src := []byte(strings.Repeat(benchScript, 1000))
+	ch := lexer.NewBytes("", src).Stream(ctx)
+
+	<-ch
+	cancel()
+
+	// The channel must be closed without ever reaching EOF.
+	for res := range ch {
+		if res.Err != nil || res.Tok.EOF() {
+			t.Fatalf("unexpected result after cancel: %v", res)
+		}
+	}
+}
+
+func TestLexFiles(t *testing.T) {
+	dir := mustTempDir(t)
+	defer os.RemoveAll(dir)
+
+	codes := []string{benchScript, "let x = 1;", "x @ y", "", "/* open"}
+
+	var filenames []string
+	for _, code := range codes {
+		_, file := mustWriteTempFile(dir, code, t)
+		filenames = append(filenames, file)
+	}
+	filenames = append(filenames, filepath.Join(dir, "missing.mky"))
+
+	results := lexer.LexFiles(context.Background(), filenames, lexer.ScanComments)
+	if len(results) != len(filenames) {
+		t.Fatalf("exp %d results, got %d", len(filenames), len(results))
+	}
+
+	for i, res := range results {
+		if res.Filename != filenames[i] {
+			t.Fatalf("result %d: exp %s, got %s", i, filenames[i], res.Filename)
+		}
+
+		if i == len(codes) {
+			if !os.IsNotExist(res.Err) {
+				t.Fatalf("%s: exp not exist error, got %v", res.Filename, res.Err)
+			}
+			continue
+		}
+
+		lex := lexer.New(filenames[i], strings.NewReader(codes[i]))
+		lex.SetMode(lexer.ScanComments)
+		exps, expErr := lexAll(lex)
+
+		var gots []*lexer.Token
+		for j := range res.Tokens {
+			gots = append(gots, &res.Tokens[j])
+		}
+
+		if !reflect.DeepEqual(exps, gots) {
+			t.Fatalf("%s: tokens don't match:\nexp: %v\ngot: %v", res.Filename, exps, gots)
+		}
+
+		if !reflect.DeepEqual(expErr, res.Err) {
+			t.Fatalf("%s: errors don't match:\nexp: %v\ngot: %v", res.Filename, expErr, res.Err)
+		}
+	}
+
+	// Cancelled batches report the context's error.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	for _, res := range lexer.LexFiles(ctx, filenames, 0) {
+		if res.Err != context.Canceled {
+			t.Fatalf("%s: exp %v, got %v", res.Filename, context.Canceled, res.Err)
+		}
+	}
+}
+
+func TestLexFiles_Config(t *testing.T) {
+	dir := mustTempDir(t)
+	defer os.RemoveAll(dir)
+
+	_, file := mustWriteTempFile(dir, "let x = 1", t)
+
+	res := lexer.LexFiles(context.Background(), []string{file}, lexer.RecoverErrors, lexer.ExpressionConfig())[0]
+	if res.Err != nil {
+		t.Fatal(res.Err)
+	}
+
+	var types []lexer.TokenType
+	for _, tok := range res.Tokens {
+		types = append(types, tok.Type)
+	}
+
+	exp := []lexer.TokenType{lexer.IDENT, lexer.IDENT, lexer.ILLEGAL, lexer.INT, lexer.EOF}
+	if !reflect.DeepEqual(exp, types) {
+		t.Fatalf("\nexp: %v\ngot: %v", exp, types)
+	}
+
+	if len(res.Errors) != 1 || res.Errors[0].Error() != file+"|1 col 7| invalid token: =" {
+		t.Fatalf("unexpected errors: %v", res.Errors)
+	}
+}
+
+// benchScript is a representative script used by the benchmarks.
+const benchScript = `// Compute some values.
+let fib = fn(n) {
+	if (n < 2) { return n; }
+	fib(n - 1) + fib(n - 2)
+};
+let values = [1, 2.5, 0xff, 1_000_000, "str", true, {"key": "value"}];
+/* block comment */
+let result = fib(10) * values[2] / 3 >= 42 && !false || values[4] == "str";
+`
+
+// BenchmarkLexer compares lexing with New and Next, the original reader-based
+// path, against NewBytes on the same script.
+func BenchmarkLexer(b *testing.B) {
+	src := strings.Repeat(benchScript, 100)
+	bsrc := []byte(src)
+
+	benchmarks := []struct {
+		name string
+		lex  func() *lexer.Lexer
+		next func(*lexer.Lexer) (bool, error)
+	}{
+		{
+			name: "New/Next",
+			lex:  func() *lexer.Lexer { return lexer.New("", strings.NewReader(src)) },
+			next: func(l *lexer.Lexer) (bool, error) {
+				tok, err := l.Next()
+				return err == nil && tok.EOF(), err
+			},
+		},
+		{
+			name: "NewBytes/Next",
+			lex:  func() *lexer.Lexer { return lexer.NewBytes("", bsrc) },
+			next: func(l *lexer.Lexer) (bool, error) {
+				tok, err := l.Next()
+				return err == nil && tok.EOF(), err
+			},
+		},
+		{
+			name: "NewBytes/Scan",
+			lex:  func() *lexer.Lexer { return lexer.NewBytes("", bsrc) },
+			next: func(l *lexer.Lexer) (bool, error) {
+				tok, err := l.Scan()
+				return tok.EOF(), err
+			},
+		},
+	}
+
+	for _, bm := range benchmarks {
+		b.Run(bm.name, func(b *testing.B) {
+			b.SetBytes(int64(len(src)))
+			b.ReportAllocs()
+
+			for i := 0; i < b.N; i++ {
+				lex := bm.lex()
+				for {
+					eof, err := bm.next(lex)
+					if err != nil {
+						b.Fatal(err)
+					}
+					if eof {
+						break
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestLexer_Relex(t *testing.T) {
+	scripts := []string{
+		benchScript,
+		"let s = `a${ {1: `b${c}d`}[1] }e${f}`;\n// ${\nlet t = `${`${x}`}`; /* { */ g}",
+		"let x = \"a\\qb\" + 0b12 @ `c${d\n\"open",
+	}
+	frags := []string{"", "x", "1", " ", "\n", "=", "<", "/", "*", "{", "}", "`", "${", "\"", "\\", "/*", "*/", "//", "é"}
+	modes := []lexer.Mode{0, lexer.RecoverErrors, lexer.RecoverErrors | lexer.ScanTrivia, lexer.RecoverErrors | lexer.ScanComments}
+
+	rnd := rand.New(rand.NewSource(1))
+	for _, mode := range modes {
+		for _, src := range scripts {
+			old, _ := scanAll(lexer.NewBytes("f", []byte(src)), mode)
+
+			for i := 0; i < 300; i++ {
+				edit := lexer.Edit{Start: rnd.Intn(len(src) + 1), Text: frags[rnd.Intn(len(frags))]}
+				edit.End = edit.Start + rnd.Intn(4)
+				if edit.End > len(src) {
+					edit.End = len(src)
+				}
+				src = src[:edit.Start] + edit.Text + src[edit.End:]
+
+				exp, expErr := scanAll(lexer.NewBytes("f", []byte(src)), mode)
+
+				lex := lexer.NewBytes("f", []byte(src))
+				lex.SetMode(mode)
+				got, gotErr := lex.Relex(old, edit)
+
+				same := len(exp) == 0 && len(got) == 0 || reflect.DeepEqual(exp, got)
+				if !same || fmt.Sprint(expErr) != fmt.Sprint(gotErr) {
+					t.Fatalf("mode %d, edit %+v of:\n%s\nexp: %+v %v\ngot: %+v %v", mode, edit, src, exp, expErr, got, gotErr)
+				}
+
+				old = got
+			}
+		}
+	}
+}
+
+func TestLexer_RelexReuse(t *testing.T) {
+	src := strings.Repeat("x + 1\n", 1000) + "@"
+
+	old, err := scanAll(lexer.NewBytes("", []byte(src)), lexer.RecoverErrors)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lex := lexer.NewBytes("", []byte("y"+src))
+	lex.SetMode(lexer.RecoverErrors)
+	toks, err := lex.Relex(old, lexer.Edit{Start: 0, End: 0, Text: "y"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The ILLEGAL token at the end is reused rather than lexed again, so
+	// no error is recorded for it.
+	if errs := lex.Errors(); len(errs) != 0 {
+		t.Fatalf("unexpected errors: %v", errs)
+	}
+
+	if got := toks[len(toks)-2]; got.Type != lexer.ILLEGAL || got.Line != 1001 || got.Col != 1 || got.Offset != len(src) {
+		t.Fatalf("unexpected token: %+v", got)
+	}
+
+	lex = lexer.NewBytes("", []byte("y"+src))
+	if _, err := lex.Relex(old, lexer.Edit{Start: 0, End: 1, Text: "z"}); err == nil {
+		t.Fatal("expected error for edit that doesn't match the source")
+	}
+}
+
+// scanAll reads all tokens from the lexer in the given mode, up to and
+// including EOF or the first error.
+func scanAll(lex *lexer.Lexer, mode lexer.Mode) ([]lexer.Token, error) {
+	lex.SetMode(mode)
+
+	var toks []lexer.Token
+	for {
+		tok, err := lex.Scan()
+		if err != nil {
+			return toks, err
+		}
+
+		toks = append(toks, tok)
+
+		if tok.EOF() {
+			return toks, nil
+		}
+	}
+}
+
+// lexAll reads all tokens from the lexer, up to and including EOF or the
+// first error.
+func lexAll(lex *lexer.Lexer) ([]*lexer.Token, error) {
+	var toks []*lexer.Token
+	for {
+		tok, err := lex.Next()
+		if err != nil {
+			return toks, err
+		}
+
+		toks = append(toks, tok)
+
+		if tok.EOF() {
+			return toks, nil
+		}
+	}
+}
+
+// tokPos holds the fields of a token that identify it in the input.
+type tokPos struct {
+	Type   lexer.TokenType
+	Line   int
+	Col    int
+	String string
+}
+
+// mustLexPos reads all tokens from the lexer, up to and including EOF.
+func mustLexPos(lex *lexer.Lexer, t *testing.T) []tokPos {
+	t.Helper()
+
+	var toks []tokPos
+	for {
+		tok, err := lex.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		toks = append(toks, tokPos{tok.Type, tok.Line, tok.Col, tok.String})
+
+		if tok.EOF() {
+			return toks
+		}
+	}
+}
+
 func mustTempDir(t *testing.T) string {
 	t.Helper()
 	dir, err := ioutil.TempDir("", "monkey_lexer")
@@ -0,0 +1,136 @@
+package lexer
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// ColumnUnit is the unit a PosEncoder counts columns in.
+type ColumnUnit int
+
+const (
+	// RuneColumns counts Unicode code points, like Token.Col.
+	RuneColumns ColumnUnit = iota
+
+	// ByteColumns counts bytes of UTF-8.
+	ByteColumns
+
+	// UTF16Columns counts UTF-16 code units, as the Language Server
+	// Protocol does by default.
+	UTF16Columns
+
+	// VisualColumns counts the columns a terminal or editor displays.
+	// Tabs advance to the next tab stop, combining marks take no space,
+	// and East Asian wide characters take two columns.
+	VisualColumns
+)
+
+// DefaultTabWidth is the tab width used by a PosEncoder if none is given.
+const DefaultTabWidth = 8
+
+// PosEncoder converts positions reported by the lexer, whose columns count
+// runes, to columns in another unit. Columns are still numbered from 1;
+// subtract 1 for tools, such as LSP clients, that number them from 0.
+type PosEncoder struct {
+	src      string
+	lines    []int // offset of the start of each line
+	unit     ColumnUnit
+	tabWidth int
+}
+
+// NewPosEncoder returns an encoder for positions in src that counts columns
+// in unit. tabWidth is the distance between tab stops for VisualColumns. If
+// it's less than 1, DefaultTabWidth is used.
+func NewPosEncoder(src []byte, unit ColumnUnit, tabWidth int) *PosEncoder {
+	if tabWidth < 1 {
+		tabWidth = DefaultTabWidth
+	}
+
+	e := &PosEncoder{
+		src:      string(src),
+		lines:    []int{0},
+		unit:     unit,
+		tabWidth: tabWidth,
+	}
+
+	for off := 0; ; {
+		i := strings.IndexByte(e.src[off:], '\n')
+		if i < 0 {
+			break
+		}
+		off += i + 1
+		e.lines = append(e.lines, off)
+	}
+
+	return e
+}
+
+// Encode returns p with its column converted to the encoder's unit. p must
+// be a position reported by the lexer, such as Token.Pos or Token.End.
+func (e *PosEncoder) Encode(p Pos) Pos {
+	p.Col = e.Column(p.Line, p.Col)
+	return p
+}
+
+// Column converts col, a column counted in runes on the given line, to
+// the encoder's unit. Columns of lines that aren't in the source are
+// returned unchanged.
+func (e *PosEncoder) Column(line, col int) int {
+	if line < 1 || line > len(e.lines) || e.unit == RuneColumns {
+		return col
+	}
+
+	s := e.src[e.lines[line-1]:]
+	w, n := 0, col-1
+	for ; n > 0 && s != "" && s[0] != '\n'; n-- {
+		r, size := utf8.DecodeRuneInString(s)
+		s = s[size:]
+
+		switch e.unit {
+		case ByteColumns:
+			w += size
+		case UTF16Columns:
+			w++
+			if r >= 0x10000 {
+				w++
+			}
+		case VisualColumns:
+			w += e.runeWidth(r, w)
+		}
+	}
+
+	// Count any columns past the end of the line, such as the position
+	// following the last token, as one unit each.
+	return w + n + 1
+}
+
+// runeWidth returns the number of visual columns r takes when it's
+// displayed w columns from the start of the line.
+func (e *PosEncoder) runeWidth(r rune, w int) int {
+	switch {
+	case r == '\t':
+		return e.tabWidth - w%e.tabWidth
+	case unicode.In(r, unicode.Mn, unicode.Me, unicode.Cf):
+		return 0
+	case isWide(r):
+		return 2
+	}
+	return 1
+}
+
+// isWide returns true if r is an East Asian wide or fullwidth character.
+// The ranges are those commonly used by terminals, from Markus Kuhn's
+// wcwidth.
+func isWide(r rune) bool {
+	return r >= 0x1100 && (r <= 0x115f || // Hangul Jamo
+		r >= 0x2e80 && r <= 0xa4cf && r != 0x303f || // CJK ... Yi
+		r >= 0xac00 && r <= 0xd7a3 || // Hangul Syllables
+		r >= 0xf900 && r <= 0xfaff || // CJK Compatibility Ideographs
+		r >= 0xfe30 && r <= 0xfe4f || // CJK Compatibility Forms
+		r >= 0xff00 && r <= 0xff60 || // Fullwidth Forms
+		r >= 0xffe0 && r <= 0xffe6 ||
+		r >= 0x1f300 && r <= 0x1f64f || // Pictographs and Emoticons
+		r >= 0x1f900 && r <= 0x1f9ff ||
+		r >= 0x20000 && r <= 0x3fffd)
+}
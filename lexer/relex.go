@@ -0,0 +1,194 @@
+package lexer
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// Edit describes a change to the text of a script: the bytes from Start up
+// to End are replaced with Text. Offsets are relative to the text before
+// the change.
+type Edit struct {
+	Start, End int
+	Text       string
+}
+
+// relexMargin is how far, in bytes, the lexer may look past the end of a
+// token to find where it ends. Lexing restarts from a token that ends at
+// least this far before an edit.
+const relexMargin = utf8.UTFMax
+
+// Relex returns the tokens of src, which is the result of applying edit to
+// a script that lexed to old. Only the region affected by the edit is
+// lexed again. Lexing restarts at a token boundary before the edit and
+// stops at the first boundary after it where the lexer is in the same state
+// as it was at the same place in the old script. The old tokens from there
+// on are reused with their positions adjusted.
+//
+// old must hold all the tokens of the old script, up to and including EOF,
+// read in the same mode and with the same Config as l. If it doesn't end
+// with EOF, src is lexed in full. l must have been created by NewBytes from
+// src and not read from yet. Errors and Warnings only return what was found
+// in the region that was lexed again.
+//
+// As with Scan, an error stops lexing. The tokens are returned up to and
+// including EOF or the first error.
+func (l *Lexer) Relex(old []Token, edit Edit) ([]Token, error) {
+	if l.r != nil || l.off > 0 || l.index > 0 {
+		panic("lexer: Relex requires a new lexer created by NewBytes")
+	}
+
+	n := len(old)
+	if n == 0 || !old[n-1].EOF() {
+		return l.relexFrom(nil, len(l.src), 0)
+	}
+
+	oldLen := old[n-1].EndOffset
+	delta := len(edit.Text) - (edit.End - edit.Start)
+	if edit.Start < 0 || edit.Start > edit.End || edit.End > oldLen || oldLen+delta != len(l.src) ||
+		l.src[edit.Start:edit.Start+len(edit.Text)] != edit.Text {
+		return nil, fmt.Errorf("lexer: edit of bytes %d-%d doesn't match the source", edit.Start, edit.End)
+	}
+
+	// Find the last boundary between tokens that's far enough before the
+	// edit to restart from, along with the lexer's state there.
+	var tmpl, restart []int
+	start, pos := 0, Pos{Line: 1, Col: 1}
+	for i := 0; i < n-1; i++ {
+		tmpl = tmplAfter(tmpl, &old[i])
+		end := fullEnd(&old[i])
+		if end.Offset+relexMargin > edit.Start {
+			break
+		}
+		start, pos, restart = i+1, end, append(restart[:0], tmpl...)
+	}
+
+	l.off, l.line, l.col = pos.Offset, pos.Line, pos.Col
+	l.tmpl = append([]int(nil), restart...)
+
+	return l.relexFrom(old[:start], edit.Start+len(edit.Text), delta, old[start:]...)
+}
+
+// relexFrom lexes from the lexer's current position, which follows the
+// tokens in prefix, until it's resynchronized with the old tokens in
+// suffix. The suffix begins at the same position in the text before the
+// edit, which ends at editEnd in the new text and changed its length by
+// delta.
+func (l *Lexer) relexFrom(prefix []Token, editEnd, delta int, suffix ...Token) ([]Token, error) {
+	toks := make([]Token, len(prefix), len(prefix)+len(suffix)+1)
+	copy(toks, prefix)
+
+	tmpl := append([]int(nil), l.tmpl...)
+	pos := Pos{Offset: l.off, Line: l.line, Col: l.col}
+
+	for {
+		tok, err := l.Scan()
+		if err != nil {
+			return toks, err
+		}
+
+		toks = append(toks, tok)
+		if tok.EOF() {
+			return toks, nil
+		}
+		if l.off < editEnd {
+			continue
+		}
+
+		// Skip old tokens up to where the new one ends, then check
+		// whether the old and new token streams agree from here on.
+		for len(suffix) > 1 && pos.Offset+delta < l.off {
+			tmpl = tmplAfter(tmpl, &suffix[0])
+			pos = fullEnd(&suffix[0])
+			suffix = suffix[1:]
+		}
+
+		if len(suffix) > 0 && pos.Offset+delta == l.off && equalInts(tmpl, l.tmpl) {
+			to := Pos{Offset: l.off, Line: l.line, Col: l.col}
+			return append(toks, l.shiftTokens(suffix, pos, to)...), nil
+		}
+	}
+}
+
+// shiftTokens returns copies of toks, which follow the position from in
+// the text before an edit, moved to follow the position to.
+func (l *Lexer) shiftTokens(toks []Token, from, to Pos) []Token {
+	shifted := make([]Token, len(toks))
+	for i, tok := range toks {
+		tok.File = l.filename
+		tok.Offset += to.Offset - from.Offset
+		tok.EndOffset += to.Offset - from.Offset
+		if tok.Line == from.Line {
+			tok.Col += to.Col - from.Col
+		}
+		if tok.EndLine == from.Line {
+			tok.EndCol += to.Col - from.Col
+		}
+		tok.Line += to.Line - from.Line
+		tok.EndLine += to.Line - from.Line
+		shifted[i] = tok
+	}
+	return shifted
+}
+
+// fullEnd returns the position following the token and its trailing
+// trivia, which is where the lexer starts reading the next token.
+func fullEnd(tok *Token) Pos {
+	p := tok.End()
+	for _, t := range tok.Trailing {
+		p.Offset += len(t.Text)
+		for _, r := range t.Text {
+			p.Col++
+			if r == '\n' {
+				p.Line++
+				p.Col = 1
+			}
+		}
+	}
+	return p
+}
+
+// tmplAfter returns the lexer's template literal state, as in Lexer.tmpl,
+// after reading tok given its state before. tmpl may be modified.
+func tmplAfter(tmpl []int, tok *Token) []int {
+	n := len(tmpl)
+	switch tok.Type {
+	case TEMPLATE_HEAD:
+		return append(tmpl, 0)
+	case TEMPLATE_TAIL:
+		return tmpl[:n-1]
+	case LBRACE:
+		if n > 0 {
+			tmpl[n-1]++
+		}
+	case RBRACE:
+		if n > 0 {
+			tmpl[n-1]--
+		}
+	case ILLEGAL:
+		// An invalid part of a template literal still ends the embedded
+		// expression before it and, if it ends with "${", begins another.
+		s := tok.String
+		if strings.HasPrefix(s, "}") && n > 0 {
+			tmpl = tmpl[:n-1]
+		}
+		if (strings.HasPrefix(s, "}") || strings.HasPrefix(s, "`")) && strings.HasSuffix(s, "${") {
+			tmpl = append(tmpl, 0)
+		}
+	}
+	return tmpl
+}
+
+// equalInts returns true if a and b hold the same values.
+func equalInts(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
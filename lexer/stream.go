@@ -0,0 +1,122 @@
+package lexer
+
+import (
+	"context"
+	"io/ioutil"
+	"runtime"
+	"sync"
+)
+
+// streamBuffer is the number of tokens Stream reads ahead of the receiver.
+const streamBuffer = 64
+
+// Result is a token or error delivered by Stream.
+type Result struct {
+	Tok Token
+	Err error
+}
+
+// Stream lexes the input in a new goroutine and delivers the tokens over
+// the returned channel. The channel is closed after the EOF token or the
+// first error, which is delivered as a Result with Err set. If ctx is
+// cancelled, lexing stops and the channel is closed without an EOF token.
+// The lexer must not be used in any other way until the channel is closed.
+func (l *Lexer) Stream(ctx context.Context) <-chan Result {
+	ch := make(chan Result, streamBuffer)
+
+	go func() {
+		defer close(ch)
+
+		for ctx.Err() == nil {
+			tok, err := l.Scan()
+
+			select {
+			case ch <- Result{Tok: tok, Err: err}:
+			case <-ctx.Done():
+				return
+			}
+
+			if err != nil || tok.EOF() {
+				return
+			}
+		}
+	}()
+
+	return ch
+}
+
+// FileResult holds the tokens of a file lexed by LexFiles.
+type FileResult struct {
+	Filename string
+	Tokens   []Token  // up to and including EOF or the first error
+	Errors   []*Error // errors recorded in RecoverErrors mode
+	Err      error    // error opening or lexing the file
+}
+
+// LexFiles lexes files in parallel, using one goroutine per CPU, with the
+// lexers in the given mode and, if cfg is given, dialect. The results are in
+// the same order as filenames. If ctx is cancelled, files that haven't been
+// completely lexed have their Err set to the context's error.
+func LexFiles(ctx context.Context, filenames []string, mode Mode, cfg ...*Config) []FileResult {
+	results := make([]FileResult, len(filenames))
+
+	next := make(chan int)
+	var wg sync.WaitGroup
+	for n := 0; n < runtime.GOMAXPROCS(0) && n < len(filenames); n++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				results[i] = lexFile(ctx, filenames[i], mode, cfg)
+			}
+		}()
+	}
+
+	for i := range filenames {
+		next <- i
+	}
+	close(next)
+	wg.Wait()
+
+	return results
+}
+
+// lexFile reads and lexes a single file for LexFiles.
+func lexFile(ctx context.Context, filename string, mode Mode, cfg []*Config) FileResult {
+	res := FileResult{Filename: filename}
+
+	if res.Err = ctx.Err(); res.Err != nil {
+		return res
+	}
+
+	src, err := ioutil.ReadFile(filename)
+	if err != nil {
+		res.Err = err
+		return res
+	}
+
+	l := NewBytes(filename, src, cfg...)
+	l.SetMode(mode)
+
+	for {
+		if res.Err = ctx.Err(); res.Err != nil {
+			return res
+		}
+
+		tok, err := l.Scan()
+		if err != nil {
+			res.Err = err
+			break
+		}
+
+		res.Tokens = append(res.Tokens, tok)
+
+		if tok.EOF() {
+			break
+		}
+	}
+
+	res.Errors = l.Errors()
+
+	return res
+}
@@ -0,0 +1,37 @@
+package object
+
+// Environment binds names to values. Environments are lexically scoped;
+// lookups that miss in an environment continue in its enclosing one.
+type Environment struct {
+	store map[string]Object
+	outer *Environment
+}
+
+// NewEnvironment returns a new top level Environment.
+func NewEnvironment() *Environment {
+	return &Environment{
+		store: make(map[string]Object),
+	}
+}
+
+// NewEnclosedEnvironment returns a new Environment nested inside outer.
+func NewEnclosedEnvironment(outer *Environment) *Environment {
+	env := NewEnvironment()
+	env.outer = outer
+	return env
+}
+
+// Get returns the value bound to name in this or any enclosing environment.
+func (e *Environment) Get(name string) (Object, bool) {
+	obj, ok := e.store[name]
+	if !ok && e.outer != nil {
+		return e.outer.Get(name)
+	}
+	return obj, ok
+}
+
+// Set binds name to val in this environment and returns val.
+func (e *Environment) Set(name string, val Object) Object {
+	e.store[name] = val
+	return val
+}
@@ -0,0 +1,312 @@
+package object
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math/big"
+	"strconv"
+	"strings"
+
+	"github.com/dgnorton/monkey/ast"
+)
+
+// Type is used to distinguish which type of value an Object holds.
+type Type int
+
+const (
+	NULL Type = iota
+	INTEGER
+	BOOLEAN
+	STRING
+	RETURN
+	ERROR
+	FUNCTION
+	ARRAY
+	HASH
+	FLOAT
+)
+
+// String returns a string representation of the object type.
+func (t Type) String() string {
+	switch t {
+	case NULL:
+		return "NULL"
+	case INTEGER:
+		return "INTEGER"
+	case BOOLEAN:
+		return "BOOLEAN"
+	case STRING:
+		return "STRING"
+	case RETURN:
+		return "RETURN"
+	case ERROR:
+		return "ERROR"
+	case FUNCTION:
+		return "FUNCTION"
+	case ARRAY:
+		return "ARRAY"
+	case HASH:
+		return "HASH"
+	case FLOAT:
+		return "FLOAT"
+	default:
+		return "INVALID OBJECT TYPE"
+	}
+}
+
+// Object represents a value produced by evaluating Monkey code. All values
+// implement this interface.
+type Object interface {
+	Type() Type
+	Inspect() string
+}
+
+// HashKey identifies a hash key by type and a hash of its value. Two
+// objects that are equal produce equal HashKeys, independent of process or
+// run, but different objects may also produce equal HashKeys.
+type HashKey struct {
+	Type  Type
+	Value uint64
+}
+
+// Hashable is implemented by objects that can be used as hash keys.
+type Hashable interface {
+	Object
+	HashKey() HashKey
+}
+
+// Null is the absence of a value.
+type Null struct{}
+
+func (o *Null) Type() Type      { return NULL }
+func (o *Null) Inspect() string { return "null" }
+
+// Integer is an integer value.
+type Integer struct {
+	Value int64
+}
+
+func (o *Integer) Type() Type       { return INTEGER }
+func (o *Integer) Inspect() string  { return strconv.FormatInt(o.Value, 10) }
+func (o *Integer) HashKey() HashKey { return HashKey{Type: INTEGER, Value: uint64(o.Value)} }
+
+// BigInteger is an integer value too large for an Integer. Monkey code sees
+// a single INTEGER type; arithmetic switches between the two representations
+// as needed. Use NewInteger to create integers from big.Ints so that values
+// that fit in an Integer are always represented as one.
+type BigInteger struct {
+	Value *big.Int
+}
+
+// NewInteger returns v as an *Integer if it fits in an int64 or as a
+// *BigInteger otherwise.
+func NewInteger(v *big.Int) Object {
+	if v.IsInt64() {
+		return &Integer{Value: v.Int64()}
+	}
+	return &BigInteger{Value: v}
+}
+
+func (o *BigInteger) Type() Type      { return INTEGER }
+func (o *BigInteger) Inspect() string { return o.Value.String() }
+
+// HashKey hashes the integer's sign and magnitude. Since BigIntegers are
+// always outside the range of an Integer, equal values hash equally
+// regardless of how they were computed.
+func (o *BigInteger) HashKey() HashKey {
+	h := fnv.New64a()
+	h.Write([]byte{byte(o.Value.Sign() + 1)})
+	h.Write(o.Value.Bytes())
+	return HashKey{Type: INTEGER, Value: h.Sum64()}
+}
+
+// Float is a 64-bit floating-point value.
+type Float struct {
+	Value float64
+}
+
+func (o *Float) Type() Type { return FLOAT }
+
+// Inspect returns the shortest representation of the value that still reads
+// as a float, e.g., "3.0" rather than "3".
+func (o *Float) Inspect() string {
+	s := strconv.FormatFloat(o.Value, 'g', -1, 64)
+	if !strings.ContainsAny(s, ".eIN") {
+		s += ".0"
+	}
+	return s
+}
+
+// Boolean is a boolean value.
+type Boolean struct {
+	Value bool
+}
+
+func (o *Boolean) Type() Type      { return BOOLEAN }
+func (o *Boolean) Inspect() string { return strconv.FormatBool(o.Value) }
+
+func (o *Boolean) HashKey() HashKey {
+	if o.Value {
+		return HashKey{Type: BOOLEAN, Value: 1}
+	}
+	return HashKey{Type: BOOLEAN, Value: 0}
+}
+
+// String is a string value.
+type String struct {
+	Value string
+}
+
+func (o *String) Type() Type      { return STRING }
+func (o *String) Inspect() string { return o.Value }
+
+func (o *String) HashKey() HashKey {
+	h := fnv.New64a()
+	h.Write([]byte(o.Value))
+	return HashKey{Type: STRING, Value: h.Sum64()}
+}
+
+// Array is an ordered list of values.
+type Array struct {
+	Elements []Object
+}
+
+func (o *Array) Type() Type { return ARRAY }
+
+func (o *Array) Inspect() string {
+	elems := make([]string, len(o.Elements))
+	for i, elem := range o.Elements {
+		elems[i] = elem.Inspect()
+	}
+	return "[" + strings.Join(elems, ", ") + "]"
+}
+
+// HashPair is a key/value pair stored in a Hash. The original key is kept
+// so the hash can be inspected.
+type HashPair struct {
+	Key   Hashable
+	Value Object
+}
+
+// Hash is a map of hashable keys to values. Pairs are inspected in the
+// order their keys were first inserted.
+type Hash struct {
+	// Pairs holds the pairs whose keys have the same HashKey. Keys within
+	// a bucket are compared with each other to tell them apart.
+	Pairs map[HashKey][]HashPair
+	keys  []Hashable
+}
+
+// NewHash returns a new, empty Hash.
+func NewHash() *Hash {
+	return &Hash{
+		Pairs: make(map[HashKey][]HashPair),
+	}
+}
+
+// Set sets the value for key.
+func (o *Hash) Set(key Hashable, val Object) {
+	hk := key.HashKey()
+	bucket := o.Pairs[hk]
+	for i, pair := range bucket {
+		if equalKeys(pair.Key, key) {
+			bucket[i].Value = val
+			return
+		}
+	}
+	o.Pairs[hk] = append(bucket, HashPair{Key: key, Value: val})
+	o.keys = append(o.keys, key)
+}
+
+// Get returns the value for key.
+func (o *Hash) Get(key Hashable) (Object, bool) {
+	for _, pair := range o.Pairs[key.HashKey()] {
+		if equalKeys(pair.Key, key) {
+			return pair.Value, true
+		}
+	}
+	return nil, false
+}
+
+func (o *Hash) Type() Type { return HASH }
+
+func (o *Hash) Inspect() string {
+	pairs := make([]string, len(o.keys))
+	for i, key := range o.keys {
+		val, _ := o.Get(key)
+		pairs[i] = inspectKey(key) + ": " + val.Inspect()
+	}
+	return "{" + strings.Join(pairs, ", ") + "}"
+}
+
+// equalKeys returns true if a and b are the same hash key.
+func equalKeys(a, b Hashable) bool {
+	switch a := a.(type) {
+	case *Integer:
+		b, ok := b.(*Integer)
+		return ok && a.Value == b.Value
+	case *BigInteger:
+		b, ok := b.(*BigInteger)
+		return ok && a.Value.Cmp(b.Value) == 0
+	case *String:
+		b, ok := b.(*String)
+		return ok && a.Value == b.Value
+	case *Boolean:
+		b, ok := b.(*Boolean)
+		return ok && a.Value == b.Value
+	}
+	return a == b
+}
+
+// inspectKey returns the string representation of a hash key. Strings are
+// quoted so that "1" and 1 are distinguishable.
+func inspectKey(key Hashable) string {
+	if s, ok := key.(*String); ok {
+		return strconv.Quote(s.Value)
+	}
+	return key.Inspect()
+}
+
+// ReturnValue wraps the value of a return statement while it unwinds to
+// the enclosing function or program.
+type ReturnValue struct {
+	Value Object
+}
+
+func (o *ReturnValue) Type() Type      { return RETURN }
+func (o *ReturnValue) Inspect() string { return o.Value.Inspect() }
+
+// Error is a runtime error. Errors propagate like return values and stop
+// evaluation of the enclosing program.
+type Error struct {
+	Message string
+	File    string
+	Line    int
+	Col     int
+}
+
+func (o *Error) Type() Type { return ERROR }
+
+func (o *Error) Inspect() string {
+	return fmt.Sprintf("%s|%d col %d| %s", o.File, o.Line, o.Col, o.Message)
+}
+
+// Error returns a string representation of the error so that runtime
+// errors can also be used as Go errors.
+func (o *Error) Error() string { return o.Inspect() }
+
+// Function is a closure: a function literal together with the environment
+// it was defined in.
+type Function struct {
+	Literal *ast.FunctionLiteral
+	Env     *Environment
+}
+
+func (o *Function) Type() Type      { return FUNCTION }
+func (o *Function) Inspect() string { return o.Literal.String() }
+
+// Defined returns the source position the function was defined at.
+func (o *Function) Defined() string {
+	tok := o.Literal.Token
+	return fmt.Sprintf("%s|%d col %d|", tok.File, tok.Line, tok.Col)
+}
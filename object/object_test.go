@@ -0,0 +1,83 @@
+package object_test
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/dgnorton/monkey/object"
+)
+
+func TestHashKey(t *testing.T) {
+	tests := []struct {
+		a, b  object.Hashable
+		equal bool
+	}{
+		{&object.String{Value: "foo"}, &object.String{Value: "foo"}, true},
+		{&object.String{Value: "foo"}, &object.String{Value: "bar"}, false},
+		{&object.Integer{Value: 1}, &object.Integer{Value: 1}, true},
+		{&object.Integer{Value: 1}, &object.Boolean{Value: true}, false},
+		{&object.Boolean{Value: false}, &object.Boolean{Value: false}, true},
+	}
+
+	for _, test := range tests {
+		if got := test.a.HashKey() == test.b.HashKey(); got != test.equal {
+			t.Fatalf("%s == %s: exp %v, got %v", test.a.Inspect(), test.b.Inspect(), test.equal, got)
+		}
+	}
+}
+
+func TestHash_Collision(t *testing.T) {
+	// An Integer whose value is a BigInteger's hash has the same HashKey.
+	bigKey := &object.BigInteger{Value: new(big.Int).Lsh(big.NewInt(1), 100)}
+	intKey := &object.Integer{Value: int64(bigKey.HashKey().Value)}
+	if bigKey.HashKey() != intKey.HashKey() {
+		t.Fatal("exp HashKeys to collide")
+	}
+
+	hash := object.NewHash()
+	hash.Set(bigKey, &object.String{Value: "big"})
+	hash.Set(intKey, &object.String{Value: "small"})
+	hash.Set(bigKey, &object.String{Value: "BIG"})
+
+	if v, ok := hash.Get(bigKey); !ok || v.Inspect() != "BIG" {
+		t.Fatalf("exp BIG, got %v", v)
+	}
+
+	if v, ok := hash.Get(intKey); !ok || v.Inspect() != "small" {
+		t.Fatalf("exp small, got %v", v)
+	}
+
+	if _, ok := hash.Get(&object.Integer{Value: 1}); ok {
+		t.Fatal("exp 1 to be missing")
+	}
+
+	exp := `{1267650600228229401496703205376: BIG, ` + intKey.Inspect() + `: small}`
+	if got := hash.Inspect(); got != exp {
+		t.Fatalf("\nexp: %s\ngot: %s", exp, got)
+	}
+}
+
+func TestEnvironment(t *testing.T) {
+	outer := object.NewEnvironment()
+	outer.Set("a", &object.Integer{Value: 1})
+	outer.Set("b", &object.Integer{Value: 2})
+
+	inner := object.NewEnclosedEnvironment(outer)
+	inner.Set("b", &object.Integer{Value: 3})
+
+	if v, ok := inner.Get("a"); !ok || v.Inspect() != "1" {
+		t.Fatalf("exp inner a = 1, got %v", v)
+	}
+
+	if v, ok := inner.Get("b"); !ok || v.Inspect() != "3" {
+		t.Fatalf("exp inner b = 3, got %v", v)
+	}
+
+	if v, ok := outer.Get("b"); !ok || v.Inspect() != "2" {
+		t.Fatalf("exp outer b = 2, got %v", v)
+	}
+
+	if _, ok := inner.Get("c"); ok {
+		t.Fatal("exp c to be unbound")
+	}
+}
@@ -10,30 +10,127 @@ import (
 
 // Parse parses a string and returns an AST.
 func Parse(code string) (*ast.Program, error) {
-	l := lexer.New("", strings.NewReader(code))
+	l := lexer.NewBytes("", []byte(code))
 	p := New(l)
 	return p.Parse()
 }
 
-// ParseFile parses a file and returns an AST.
+// ParseFile parses a file and returns an AST. The file is closed when
+// parsing is done.
 func ParseFile(filename string) (*ast.Program, error) {
 	p, err := Open(filename)
 	if err != nil {
 		return nil, err
 	}
+	defer p.lex.Close()
 	return p.Parse()
 }
 
+// Operator precedence levels, from lowest to highest binding.
+const (
+	_ int = iota
+	precLowest
+	precOr          // ||
+	precAnd         // &&
+	precEquals      // == !=
+	precLessGreater // < > <= >=
+	precSum         // + - | ^
+	precProduct     // * / % & << >>
+	precPrefix      // -x !x
+	precCall        // fn(x)
+	precIndex       // a[i]
+)
+
+// precedences maps infix operator token types to their precedence.
+var precedences = map[lexer.TokenType]int{
+	lexer.OR:      precOr,
+	lexer.AND:     precAnd,
+	lexer.EQ:      precEquals,
+	lexer.NEQ:     precEquals,
+	lexer.LT:      precLessGreater,
+	lexer.GT:      precLessGreater,
+	lexer.LTE:     precLessGreater,
+	lexer.GTE:     precLessGreater,
+	lexer.ADD:     precSum,
+	lexer.SUB:     precSum,
+	lexer.BITOR:   precSum,
+	lexer.XOR:     precSum,
+	lexer.MUL:     precProduct,
+	lexer.DIV:     precProduct,
+	lexer.MOD:     precProduct,
+	lexer.BITAND:  precProduct,
+	lexer.SHL:     precProduct,
+	lexer.SHR:     precProduct,
+	lexer.LPAREN:  precCall,
+	lexer.LSQUARE: precIndex,
+}
+
+type (
+	// prefixFn parses an expression that begins with the next token.
+	prefixFn func() (ast.Expression, error)
+	// infixFn parses an expression whose next token follows left.
+	infixFn func(left ast.Expression) (ast.Expression, error)
+)
+
 // Parser is a Monkey language parser.
 type Parser struct {
-	lex *lexer.Lexer
+	lex    *lexer.Lexer
+	prev   *lexer.Token // last token consumed
+	rbrace *lexer.Token // "}" that closed the last block
+	errs   ErrorList
+
+	prefixFns map[lexer.TokenType]prefixFn
+	infixFns  map[lexer.TokenType]infixFn
 }
 
 // New returns a new Parser.
 func New(l *lexer.Lexer) *Parser {
-	return &Parser{
+	p := &Parser{
 		lex: l,
 	}
+
+	p.prefixFns = map[lexer.TokenType]prefixFn{
+		lexer.IDENT:         p.identPrefix,
+		lexer.INT:           p.intExpr,
+		lexer.FLOAT:         p.floatLiteral,
+		lexer.STRING:        p.stringLiteral,
+		lexer.TEMPLATE:      p.templateLiteral,
+		lexer.TEMPLATE_HEAD: p.templateLiteral,
+		lexer.TRUE:          p.boolExpr,
+		lexer.FALSE:         p.boolExpr,
+		lexer.NOT:           p.prefixExpr,
+		lexer.SUB:           p.prefixExpr,
+		lexer.LPAREN:        p.groupExpr,
+		lexer.FN:            p.functionLiteral,
+		lexer.IF:            p.ifExpr,
+		lexer.LSQUARE:       p.arrayLiteral,
+		lexer.LBRACE:        p.hashLiteral,
+	}
+
+	p.infixFns = map[lexer.TokenType]infixFn{
+		lexer.OR:      p.infixExpr,
+		lexer.AND:     p.infixExpr,
+		lexer.EQ:      p.infixExpr,
+		lexer.NEQ:     p.infixExpr,
+		lexer.LT:      p.infixExpr,
+		lexer.GT:      p.infixExpr,
+		lexer.LTE:     p.infixExpr,
+		lexer.GTE:     p.infixExpr,
+		lexer.ADD:     p.infixExpr,
+		lexer.SUB:     p.infixExpr,
+		lexer.BITOR:   p.infixExpr,
+		lexer.XOR:     p.infixExpr,
+		lexer.MUL:     p.infixExpr,
+		lexer.DIV:     p.infixExpr,
+		lexer.MOD:     p.infixExpr,
+		lexer.BITAND:  p.infixExpr,
+		lexer.SHL:     p.infixExpr,
+		lexer.SHR:     p.infixExpr,
+		lexer.LPAREN:  p.callExpr,
+		lexer.LSQUARE: p.indexExpr,
+	}
+
+	return p
 }
 
 // Open opens a file and returns a parser for it.
@@ -45,33 +142,95 @@ func Open(filename string) (*Parser, error) {
 	return New(l), nil
 }
 
-// Parse parses the output of its lexer and returns an AST.
-func (p *Parser) Parse() (*ast.Program, error) {
-	prog := ast.NewProgram()
+// Parse parses the output of its lexer and returns an AST. Parsing doesn't
+// stop at the first error. Instead, the parser skips ahead to the next
+// statement and keeps going so that every error in the input is reported.
+// If there were errors, the returned error is an ErrorList and the program
+// contains only the statements that parsed successfully.
+func (p *Parser) Parse() (prog *ast.Program, err error) {
+	prog = ast.NewProgram()
+
+	defer func() {
+		if r := recover(); r != nil {
+			if _, ok := r.(bailout); !ok {
+				panic(r)
+			}
+		}
+		err = p.errs.Err()
+	}()
+
 	for {
 		tok, err := p.lex.Peek()
 		if err != nil {
-			return nil, err
+			p.addErr(err)
+			continue
 		}
 
-		var stmt ast.Statement
-
-		switch tok.Type {
-		case lexer.LET:
-			stmt, err = p.letStmt()
-		case lexer.EOF:
+		if tok.EOF() {
 			return prog, nil
-		default:
-			err = fmt.Errorf("invalid token: %s", tok.String)
 		}
 
+		stmt, err := p.stmt()
 		if err != nil {
-			return nil, err
+			p.addErr(err)
+			p.sync(false)
+			continue
 		}
 
-		if stmt != nil {
-			prog.AddStmt(stmt)
+		prog.AddStmt(stmt)
+	}
+}
+
+// stmt parses a single statement of any kind.
+func (p *Parser) stmt() (ast.Statement, error) {
+	tok, err := p.lex.Peek()
+	if err != nil {
+		return nil, err
+	}
+
+	switch tok.Type {
+	case lexer.LET:
+		return p.letStmt()
+	case lexer.RETURN:
+		return p.returnStmt()
+	default:
+		return p.exprStmt()
+	}
+}
+
+func (p *Parser) blockStmt() (*ast.BlockStatement, error) {
+	// "{"
+	lbrace, err := p.requireTok(lexer.LBRACE)
+	if err != nil {
+		return nil, err
+	}
+
+	block := ast.NewBlockStatement(lbrace)
+
+	for {
+		tok, err := p.lex.Peek()
+		if err != nil {
+			p.addErr(err)
+			continue
+		}
+
+		// "}"
+		if tok.Type == lexer.RBRACE || tok.EOF() {
+			if block.Rbrace, err = p.requireTok(lexer.RBRACE); err != nil {
+				return nil, err
+			}
+			p.rbrace = block.Rbrace
+			return block, nil
 		}
+
+		stmt, err := p.stmt()
+		if err != nil {
+			p.addErr(err)
+			p.sync(true)
+			continue
+		}
+
+		block.AddStmt(stmt)
 	}
 }
 
@@ -84,6 +243,9 @@ func (p *Parser) letStmt() (*ast.LetStmt, error) {
 
 	// Name identifier
 	name, err := p.identExpr()
+	if err != nil {
+		return nil, err
+	}
 
 	// "="
 	_, err = p.requireTok(lexer.ASSIGN)
@@ -92,34 +254,172 @@ func (p *Parser) letStmt() (*ast.LetStmt, error) {
 	}
 
 	// Expression
-	value, err := p.expr()
+	value, err := p.expr(precLowest)
+	if err != nil {
+		return nil, err
+	}
+
+	stmt := ast.NewLetStmt(letTok, name, value)
+
+	if stmt.Semicolon, err = p.stmtEnd(); err != nil {
+		return nil, err
+	}
+
+	return stmt, nil
+}
+
+func (p *Parser) exprStmt() (*ast.ExpressionStmt, error) {
+	tok, err := p.lex.Peek()
+	if err != nil {
+		return nil, err
+	}
+
+	// Expression
+	expr, err := p.expr(precLowest)
+	if err != nil {
+		return nil, err
+	}
+
+	stmt := ast.NewExpressionStmt(tok, expr)
+
+	if stmt.Semicolon, err = p.stmtEnd(); err != nil {
+		return nil, err
+	}
+
+	return stmt, nil
+}
+
+func (p *Parser) returnStmt() (*ast.ReturnStmt, error) {
+	// "return"
+	retTok, err := p.requireTok(lexer.RETURN)
 	if err != nil {
 		return nil, err
 	}
 
-	// ";"
-	_, err = p.requireTok(lexer.SEMICOLON)
+	tok, err := p.lex.Peek()
+	if err != nil {
+		return nil, err
+	}
+
+	// Optional expression
+	var value ast.Expression
+	if tok.Type != lexer.SEMICOLON && tok.Type != lexer.RBRACE && !tok.EOF() {
+		if value, err = p.expr(precLowest); err != nil {
+			return nil, err
+		}
+	}
+
+	stmt := ast.NewReturnStmt(retTok, value)
+
+	if stmt.Semicolon, err = p.stmtEnd(); err != nil {
+		return nil, err
+	}
+
+	return stmt, nil
+}
+
+// stmtEnd consumes the optional ";" ending a statement. The ";" may only be
+// omitted before the end of a block or input, after a statement ending in a
+// block, or when the next statement starts on a new line. This lets the last
+// expression of a block double as its value without allowing "a b". The
+// ";" token is returned or nil if it was omitted.
+func (p *Parser) stmtEnd() (*lexer.Token, error) {
+	tok, err := p.lex.Peek()
 	if err != nil {
 		return nil, err
 	}
 
-	return ast.NewLetStmt(letTok, name, value), nil
+	switch {
+	case tok.Type == lexer.SEMICOLON:
+		return p.next()
+	case tok.Type == lexer.RBRACE || tok.EOF():
+		return nil, nil
+	case p.prev == p.rbrace || tok.Line > p.prev.EndLine:
+		return nil, nil
+	}
+
+	return p.requireTok(lexer.SEMICOLON)
 }
 
-func (p *Parser) expr() (ast.Expression, error) {
+// sync skips tokens after a parse error until a point where parsing can
+// resume: just past a ";", before a statement keyword, before the "}" closing
+// the current block (if inBlock) or at the end of input. Braces opened while
+// skipping are matched so parsing resumes at the nesting level the error
+// occurred at.
+func (p *Parser) sync(inBlock bool) {
+	depth := 0
 	for {
 		tok, err := p.lex.Peek()
 		if err != nil {
-			return nil, p.parseErr(tok, err)
+			p.addErr(err)
+			continue
 		}
-		if tok.Type == lexer.SEMICOLON || tok.EOF() {
-			return nil, nil
+
+		switch tok.Type {
+		case lexer.EOF:
+			return
+		case lexer.SEMICOLON:
+			if depth == 0 {
+				p.next()
+				return
+			}
+		case lexer.LET, lexer.RETURN:
+			if depth == 0 {
+				return
+			}
+		case lexer.LBRACE:
+			depth++
+		case lexer.RBRACE:
+			if depth > 0 {
+				depth--
+			} else if inBlock {
+				return
+			}
+		}
+
+		p.next()
+	}
+}
+
+// expr parses an expression using precedence climbing. Operators that bind
+// no tighter than prec are left for the caller.
+func (p *Parser) expr(prec int) (ast.Expression, error) {
+	tok, err := p.lex.Peek()
+	if err != nil {
+		return nil, err
+	}
+
+	prefix, ok := p.prefixFns[tok.Type]
+	if !ok {
+		return nil, p.parseErr(tok, fmt.Errorf("unexpected token: %s", tok.Type))
+	}
+
+	left, err := prefix()
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		tok, err := p.lex.Peek()
+		if err != nil {
+			return nil, err
+		}
+
+		infix, ok := p.infixFns[tok.Type]
+		if !ok || prec >= precedences[tok.Type] {
+			return left, nil
 		}
 
-		p.lex.Next()
+		if left, err = infix(left); err != nil {
+			return nil, err
+		}
 	}
 }
 
+func (p *Parser) identPrefix() (ast.Expression, error) {
+	return p.identExpr()
+}
+
 func (p *Parser) identExpr() (*ast.IdentExpr, error) {
 	tok, err := p.requireTok(lexer.IDENT)
 	if err != nil {
@@ -128,17 +428,378 @@ func (p *Parser) identExpr() (*ast.IdentExpr, error) {
 	return ast.NewIdentExpr(tok), nil
 }
 
-func (p *Parser) requireTok(expType lexer.TokenType) (*lexer.Token, error) {
+func (p *Parser) intExpr() (ast.Expression, error) {
+	tok, err := p.requireTok(lexer.INT)
+	if err != nil {
+		return nil, err
+	}
+	return ast.NewIntExpr(tok), nil
+}
+
+func (p *Parser) floatLiteral() (ast.Expression, error) {
+	tok, err := p.requireTok(lexer.FLOAT)
+	if err != nil {
+		return nil, err
+	}
+	return ast.NewFloatLiteral(tok), nil
+}
+
+func (p *Parser) stringLiteral() (ast.Expression, error) {
+	tok, err := p.requireTok(lexer.STRING)
+	if err != nil {
+		return nil, err
+	}
+	return ast.NewStringLiteral(tok), nil
+}
+
+// templateLiteral parses a template literal. The lexer splits a template
+// into tokens for the text between embedded expressions; the expressions
+// themselves are lexed as usual.
+func (p *Parser) templateLiteral() (ast.Expression, error) {
+	// "`text`" or "`text${"
+	first, err := p.next()
+	if err != nil {
+		return nil, err
+	}
+
+	tok := first
+	parts := []ast.Expression{ast.NewStringLiteral(tok)}
+
+	for tok.Type != lexer.TEMPLATE && tok.Type != lexer.TEMPLATE_TAIL {
+		expr, err := p.expr(precLowest)
+		if err != nil {
+			return nil, err
+		}
+		parts = append(parts, expr)
+
+		// "}text${" or "}text`"
+		if tok, err = p.lex.Peek(); err != nil {
+			return nil, err
+		}
+
+		if tok.Type != lexer.TEMPLATE_MIDDLE && tok.Type != lexer.TEMPLATE_TAIL {
+			return nil, p.parseErr(tok, fmt.Errorf("expected } after template expression, got %s", tok.Type))
+		}
+
+		if tok, err = p.next(); err != nil {
+			return nil, err
+		}
+		parts = append(parts, ast.NewStringLiteral(tok))
+	}
+
+	return ast.NewTemplateLiteral(first, parts), nil
+}
+
+func (p *Parser) boolExpr() (ast.Expression, error) {
+	tok, err := p.next()
+	if err != nil {
+		return nil, err
+	}
+	return ast.NewBoolExpr(tok), nil
+}
+
+func (p *Parser) prefixExpr() (ast.Expression, error) {
+	tok, err := p.next()
+	if err != nil {
+		return nil, err
+	}
+
+	right, err := p.expr(precPrefix)
+	if err != nil {
+		return nil, err
+	}
+
+	return ast.NewPrefixExpr(tok, right), nil
+}
+
+func (p *Parser) infixExpr(left ast.Expression) (ast.Expression, error) {
+	tok, err := p.next()
+	if err != nil {
+		return nil, err
+	}
+
+	right, err := p.expr(precedences[tok.Type])
+	if err != nil {
+		return nil, err
+	}
+
+	return ast.NewInfixExpr(tok, left, right), nil
+}
+
+func (p *Parser) groupExpr() (ast.Expression, error) {
+	// "("
+	lparen, err := p.requireTok(lexer.LPAREN)
+	if err != nil {
+		return nil, err
+	}
+
+	expr, err := p.expr(precLowest)
+	if err != nil {
+		return nil, err
+	}
+
+	// ")"
+	rparen, err := p.requireTok(lexer.RPAREN)
+	if err != nil {
+		return nil, err
+	}
+
+	return ast.NewParenExpr(lparen, expr, rparen), nil
+}
+
+func (p *Parser) ifExpr() (ast.Expression, error) {
+	// "if"
+	ifTok, err := p.requireTok(lexer.IF)
+	if err != nil {
+		return nil, err
+	}
+
+	// Condition
+	cond, err := p.expr(precLowest)
+	if err != nil {
+		return nil, err
+	}
+
+	// Consequence
+	consequence, err := p.blockStmt()
+	if err != nil {
+		return nil, err
+	}
+
+	// Optional "else" followed by a block or another "if"
+	tok, err := p.lex.Peek()
+	if err != nil {
+		return nil, err
+	}
+
+	if tok.Type != lexer.ELSE {
+		return ast.NewIfExpression(ifTok, cond, consequence, nil), nil
+	}
+	p.next()
+
+	if tok, err = p.lex.Peek(); err != nil {
+		return nil, err
+	}
+
+	var alternative *ast.BlockStatement
+	if tok.Type == lexer.IF {
+		elseIf, err := p.ifExpr()
+		if err != nil {
+			return nil, err
+		}
+
+		alternative = ast.NewBlockStatement(tok)
+		alternative.AddStmt(ast.NewExpressionStmt(tok, elseIf))
+	} else if alternative, err = p.blockStmt(); err != nil {
+		return nil, err
+	}
+
+	return ast.NewIfExpression(ifTok, cond, consequence, alternative), nil
+}
+
+func (p *Parser) functionLiteral() (ast.Expression, error) {
+	// "fn"
+	fnTok, err := p.requireTok(lexer.FN)
+	if err != nil {
+		return nil, err
+	}
+
+	// "("
+	if _, err := p.requireTok(lexer.LPAREN); err != nil {
+		return nil, err
+	}
+
+	// Parameter identifiers and ")"
+	params := []*ast.IdentExpr{}
+	for {
+		tok, err := p.lex.Peek()
+		if err != nil {
+			return nil, err
+		}
+
+		if tok.Type == lexer.RPAREN {
+			p.next()
+			break
+		}
+
+		if len(params) > 0 {
+			if _, err := p.requireTok(lexer.COMMA); err != nil {
+				return nil, err
+			}
+		}
+
+		param, err := p.identExpr()
+		if err != nil {
+			return nil, err
+		}
+
+		params = append(params, param)
+	}
+
+	// Body
+	body, err := p.blockStmt()
+	if err != nil {
+		return nil, err
+	}
+
+	return ast.NewFunctionLiteral(fnTok, params, body), nil
+}
+
+func (p *Parser) callExpr(fn ast.Expression) (ast.Expression, error) {
+	// "("
+	lparen, err := p.requireTok(lexer.LPAREN)
+	if err != nil {
+		return nil, err
+	}
+
+	// Arguments and ")"
+	args, rparen, err := p.exprList(lexer.RPAREN)
+	if err != nil {
+		return nil, err
+	}
+
+	return ast.NewCallExpression(lparen, fn, args, rparen), nil
+}
+
+func (p *Parser) arrayLiteral() (ast.Expression, error) {
+	// "["
+	lsquare, err := p.requireTok(lexer.LSQUARE)
+	if err != nil {
+		return nil, err
+	}
+
+	// Elements and "]"
+	elems, rsquare, err := p.exprList(lexer.RSQUARE)
+	if err != nil {
+		return nil, err
+	}
+
+	return ast.NewArrayLiteral(lsquare, elems, rsquare), nil
+}
+
+// hashLiteral parses a hash literal. A "{" is only ever a block where the
+// grammar requires one (after "fn(...)", "if" and "else"), so any "{" that
+// begins an expression, including one at the start of a statement, is a
+// hash literal.
+func (p *Parser) hashLiteral() (ast.Expression, error) {
+	// "{"
+	lbrace, err := p.requireTok(lexer.LBRACE)
+	if err != nil {
+		return nil, err
+	}
+
+	// Key / value pairs and "}"
+	pairs := []ast.HashPair{}
+	for {
+		tok, err := p.lex.Peek()
+		if err != nil {
+			return nil, err
+		}
+
+		if tok.Type == lexer.RBRACE {
+			p.next()
+			return ast.NewHashLiteral(lbrace, pairs, tok), nil
+		}
+
+		if len(pairs) > 0 {
+			if _, err := p.requireTok(lexer.COMMA); err != nil {
+				return nil, err
+			}
+		}
+
+		key, err := p.expr(precLowest)
+		if err != nil {
+			return nil, err
+		}
+
+		if _, err := p.requireTok(lexer.COLON); err != nil {
+			return nil, err
+		}
+
+		value, err := p.expr(precLowest)
+		if err != nil {
+			return nil, err
+		}
+
+		pairs = append(pairs, ast.HashPair{Key: key, Value: value})
+	}
+}
+
+func (p *Parser) indexExpr(left ast.Expression) (ast.Expression, error) {
+	// "["
+	lsquare, err := p.requireTok(lexer.LSQUARE)
+	if err != nil {
+		return nil, err
+	}
+
+	// Index
+	index, err := p.expr(precLowest)
+	if err != nil {
+		return nil, err
+	}
+
+	// "]"
+	rsquare, err := p.requireTok(lexer.RSQUARE)
+	if err != nil {
+		return nil, err
+	}
+
+	return ast.NewIndexExpression(lsquare, left, index, rsquare), nil
+}
+
+// exprList parses a comma separated list of expressions up to and
+// including the end token, which is also returned.
+func (p *Parser) exprList(end lexer.TokenType) ([]ast.Expression, *lexer.Token, error) {
+	exprs := []ast.Expression{}
+	for {
+		tok, err := p.lex.Peek()
+		if err != nil {
+			return nil, nil, err
+		}
+
+		if tok.Type == end {
+			p.next()
+			return exprs, tok, nil
+		}
+
+		if len(exprs) > 0 {
+			if _, err := p.requireTok(lexer.COMMA); err != nil {
+				return nil, nil, err
+			}
+		}
+
+		expr, err := p.expr(precLowest)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		exprs = append(exprs, expr)
+	}
+}
+
+// next consumes and returns the next token.
+func (p *Parser) next() (*lexer.Token, error) {
 	tok, err := p.lex.Next()
 	if err != nil {
 		return nil, err
 	}
+	p.prev = tok
+	return tok, nil
+}
+
+// requireTok consumes and returns the next token if it's of the expected
+// type. Otherwise, the token is left in place for error recovery.
+func (p *Parser) requireTok(expType lexer.TokenType) (*lexer.Token, error) {
+	tok, err := p.lex.Peek()
+	if err != nil {
+		return nil, err
+	}
 
 	if tok.Type != expType {
-		return nil, p.parseErr(tok, err)
+		return nil, p.parseErr(tok, fmt.Errorf("expected %s, got %s", expType, tok.Type))
 	}
 
-	return tok, nil
+	return p.next()
 }
 
 func (p *Parser) parseErr(tok *lexer.Token, err error) *Error {
@@ -148,13 +809,69 @@ func (p *Parser) parseErr(tok *lexer.Token, err error) *Error {
 	}
 }
 
+// addErr records an error. Lexer errors are wrapped in an Error. If err is
+// identical to the previous error the parser isn't making progress, e.g.,
+// because the underlying reader keeps failing, so parsing is abandoned.
+func (p *Parser) addErr(err error) {
+	e, ok := err.(*Error)
+	if !ok {
+		e = &Error{Err: err}
+	}
+
+	if n := len(p.errs); n > 0 && p.errs[n-1].Error() == e.Error() {
+		panic(bailout{})
+	}
+
+	p.errs = append(p.errs, e)
+}
+
+// bailout is panicked to abandon parsing and recovered by Parse.
+type bailout struct{}
+
 // Error represents a parse error.
 type Error struct {
 	Err error
-	Tok *lexer.Token
+	Tok *lexer.Token // nil for errors reported by the lexer
 }
 
 // Error returns a string representation of the error.
 func (e *Error) Error() string {
+	if e.Tok == nil {
+		return e.Err.Error()
+	}
 	return fmt.Sprintf("%s|%d col %d| %s", e.Tok.File, e.Tok.Line, e.Tok.Col, e.Err)
 }
+
+// Pos returns the position of the error as reported by the lexer, with the
+// column counted in runes, or the zero Pos if the error has no position.
+// Lexer errors don't record an offset, so their Offset is -1. Use a
+// lexer.PosEncoder to count the column in another unit.
+func (e *Error) Pos() lexer.Pos {
+	if e.Tok != nil {
+		return e.Tok.Pos()
+	}
+	if err, ok := e.Err.(*lexer.Error); ok {
+		return lexer.Pos{Offset: -1, Line: err.Line, Col: err.Col}
+	}
+	return lexer.Pos{}
+}
+
+// ErrorList is a list of parse errors in the order they were found.
+type ErrorList []*Error
+
+// Error returns all errors in the list, one per line.
+func (l ErrorList) Error() string {
+	errs := make([]string, len(l))
+	for i, err := range l {
+		errs[i] = err.Error()
+	}
+	return strings.Join(errs, "\n")
+}
+
+// Err returns the list as an error or nil if the list is empty.
+func (l ErrorList) Err() error {
+	if len(l) == 0 {
+		return nil
+	}
+	return l
+}
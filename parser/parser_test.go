@@ -1,8 +1,13 @@
 package parser_test
 
 import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"testing"
 
+	"github.com/dgnorton/monkey/lexer"
 	"github.com/dgnorton/monkey/parser"
 )
 
@@ -14,3 +19,278 @@ func TestParse(t *testing.T) {
 	_ = prog
 	//fmt.Println(prog.TokenLiteral())
 }
+
+func TestParse_Expressions(t *testing.T) {
+	tests := []struct {
+		code string
+		exp  string
+	}{
+		{"let x = 5;", "let x = 5;"},
+		{"let x = y;", "let x = y;"},
+		{"let x = true;", "let x = true;"},
+		{"let x = -a;", "let x = (-a);"},
+		{"let x = !true;", "let x = (!true);"},
+		{"let x = !-a;", "let x = (!(-a));"},
+		{"let x = a + b - c;", "let x = ((a + b) - c);"},
+		{"let x = a + b * c;", "let x = (a + (b * c));"},
+		{"let x = a * b / c;", "let x = ((a * b) / c);"},
+		{"let x = -a * b;", "let x = ((-a) * b);"},
+		{"let x = a + b * c + d / e - f;", "let x = (((a + (b * c)) + (d / e)) - f);"},
+		{"let x = 5 > 4 == 3 < 4;", "let x = ((5 > 4) == (3 < 4));"},
+		{"let x = 3 + 4 * 5 != 3 * 1 + 4 * 5;", "let x = ((3 + (4 * 5)) != ((3 * 1) + (4 * 5)));"},
+		{"let x = (a + b) * c;", "let x = ((a + b) * c);"},
+		{"let x = -(5 + 5);", "let x = (-(5 + 5));"},
+		{"let x = !(true == false);", "let x = (!(true == false));"},
+		{`let x = "a\tb";`, `let x = "a\tb";`},
+		{"let f = fn() {};", "let f = fn() { };"},
+		{"let f = fn(x) { x };", "let f = fn(x) { x; };"},
+		{"let f = fn(a, b) { let c = a + b; c; };", "let f = fn(a, b) { let c = (a + b); c; };"},
+		{"let x = add(1, 2 * 3, 4 + 5);", "let x = add(1, (2 * 3), (4 + 5));"},
+		{"let x = a + add(b * c) + d;", "let x = ((a + add((b * c))) + d);"},
+		{"let x = add(a, b, 1, 2 * 3, add(6, 7 * 8));", "let x = add(a, b, 1, (2 * 3), add(6, (7 * 8)));"},
+		{"let x = -f(1);", "let x = (-f(1));"},
+		{"let x = fn(a) { fn(b) { a + b } }(1)(2);", "let x = fn(a) { fn(b) { (a + b); }; }(1)(2);"},
+		{"let x = if (a < b) { a };", "let x = if (a < b) { a; };"},
+		{"let x = if a < b { a } else { b };", "let x = if (a < b) { a; } else { b; };"},
+		{"let x = if (a) { 1 } else if (b) { 2 } else { 3 };", "let x = if a { 1; } else { if b { 2; } else { 3; }; };"},
+		{"let f = fn(x) { return x * 2; };", "let f = fn(x) { return (x * 2); };"},
+		{"let f = fn(x) { if (x) { return; } return x };", "let f = fn(x) { if x { return; }; return x; };"},
+		{"return 5", "return 5;"},
+		{"if (x) { 1 };", "if x { 1; };"},
+		{"add(1, 2)", "add(1, 2);"},
+		{"[]", "[];"},
+		{"[1, 2 * 3, f(x)]", "[1, (2 * 3), f(x)];"},
+		{"a[1 + 1]", "(a[(1 + 1)]);"},
+		{"a * [1, 2][b * c] * d", "((a * ([1, 2][(b * c)])) * d);"},
+		{"f(a)[0]", "(f(a)[0]);"},
+		{"a[0](1)", "(a[0])(1);"},
+		{"-a[0]", "(-(a[0]));"},
+		{"a[0][1]", "((a[0])[1]);"},
+		{"{}", "{};"},
+		{`{"one": 1, "two": 1 + 1, 3: [3]}`, `{"one": 1, "two": (1 + 1), 3: [3]};`},
+		{`{"a": {"b": 1}}["a"]["b"]`, `(({"a": {"b": 1}}["a"])["b"]);`},
+		{"fn() { {a: 1} }", "fn() { {a: 1}; };"},
+		{"if (x) { {} } else { {1: 2}[1] }", "if x { {}; } else { ({1: 2}[1]); };"},
+		{"a\nb\n", "a;b;"},
+		{"a; b; c", "a;b;c;"},
+		{"if (x) { 1 } y", "if x { 1; };y;"},
+		{"let f = fn(x) {\n  let y = x * 2\n  ;y\n};", "let f = fn(x) { let y = (x * 2); y; };"},
+		{"fn() { a\n b }", "fn() { a; b; };"},
+		{"a // b\n/* c */ d", "a;d;"},
+		{"1.5 * .5 + 1e3", "((1.5 * .5) + 1e3);"},
+		{"`plain`", "`plain`;"},
+		{"`a ${b + c} d ${e}`", "`a ${(b + c)} d ${e}`;"},
+		{"`${ {1: 2}[1] }`", "`${({1: 2}[1])}`;"},
+		{"`a ${`b ${c}`}`", "`a ${`b ${c}`}`;"},
+		{"`\\` \\${x} \\\\`", "`\\` \\${x} \\\\`;"},
+		{"f(`${x}`, 1)", "f(`${x}`, 1);"},
+		{"a <= b == c >= d", "((a <= b) == (c >= d));"},
+		{"a || b && c || d", "((a || (b && c)) || d);"},
+		{"a == b && c != d", "((a == b) && (c != d));"},
+		{"a + b % c * d", "(a + ((b % c) * d));"},
+		{"a | b & c ^ d", "((a | (b & c)) ^ d);"},
+		{"a << b + c >> d", "((a << b) + (c >> d));"},
+		{"x & 1 == 0", "((x & 1) == 0);"},
+		{"!a && -b < c", "((!a) && ((-b) < c));"},
+	}
+
+	for _, test := range tests {
+		prog, err := parser.Parse(test.code)
+		if err != nil {
+			t.Fatalf("%s: %s", test.code, err)
+		}
+
+		if got := prog.String(); got != test.exp {
+			t.Fatalf("%s:\nexp: %s\ngot: %s", test.code, test.exp, got)
+		}
+	}
+}
+
+func TestParse_Errors(t *testing.T) {
+	tests := []struct {
+		code string
+		exp  string
+	}{
+		{"let x = ;", "|1 col 9| unexpected token: SEMICOLON"},
+		{"let x = (1 + 2;", "|1 col 15| expected RPAREN, got SEMICOLON"},
+		{"let = 5;", "|1 col 5| expected IDENT, got ASSIGN"},
+		{"let x = 5 6", "|1 col 11| expected SEMICOLON, got INT"},
+		{"let f = fn(a b) {};", "|1 col 14| expected COMMA, got IDENT"},
+		{"let f = fn(1) {};", "|1 col 12| expected IDENT, got INT"},
+		{"let f = fn(a) { a;", "|1 col 19| expected RBRACE, got EOF"},
+		{"let x = add(1, 2;", "|1 col 17| expected COMMA, got SEMICOLON"},
+		{"let x = if (a) 1;", "|1 col 16| expected LBRACE, got INT"},
+		{"let x = if (a) { 1 } else 2;", "|1 col 27| expected LBRACE, got INT"},
+		{"return 1 2", "|1 col 10| expected SEMICOLON, got INT"},
+		{"a b", "|1 col 3| expected SEMICOLON, got IDENT"},
+		{"[1, 2", "|1 col 6| expected COMMA, got EOF"},
+		{"a[1", "|1 col 4| expected RSQUARE, got EOF"},
+		{"{1 2}", "|1 col 4| expected COLON, got INT"},
+		{"{1: 2 3: 4}", "|1 col 7| expected COMMA, got INT"},
+		{"{1: 2} 3", "|1 col 8| expected SEMICOLON, got INT"},
+		{`let h = {"a": 1} h`, "|1 col 18| expected SEMICOLON, got IDENT"},
+		{"fn() { a b }", "|1 col 10| expected SEMICOLON, got IDENT"},
+		{"let s = \"a\nb\" x", "|2 col 4| expected SEMICOLON, got IDENT"},
+		{"let s = `a\n${b}\nc` d", "|3 col 4| expected SEMICOLON, got IDENT"},
+		{"`a ${b c}`", "|1 col 8| expected } after template expression, got IDENT"},
+		{"`a ${b", "|1 col 7| expected } after template expression, got EOF"},
+	}
+
+	for _, test := range tests {
+		_, err := parser.Parse(test.code)
+		if err == nil {
+			t.Fatalf("%s: expected error", test.code)
+		}
+
+		if got := err.Error(); got != test.exp {
+			t.Fatalf("%s:\nexp: %s\ngot: %s", test.code, test.exp, got)
+		}
+	}
+}
+
+func TestParse_MultipleErrors(t *testing.T) {
+	code := `let x = ;
+let y = 5;
+let z = (1 + ;
+}
+let f = fn() {
+  let a = ;
+  if (a { 1 } 
+  a
+};
+let s = "a\qb"; let t = 1;
+let u = 2;
+` + "let v = `a\\q ${x}`;\n" + `let w = "abc
+`
+
+	prog, err := parser.Parse(code)
+
+	errs, ok := err.(parser.ErrorList)
+	if !ok {
+		t.Fatalf("exp parser.ErrorList, got %T: %v", err, err)
+	}
+
+	exp := `|1 col 9| unexpected token: SEMICOLON
+|3 col 14| unexpected token: SEMICOLON
+|4 col 1| unexpected token: RBRACE
+|6 col 11| unexpected token: SEMICOLON
+|7 col 9| expected RPAREN, got LBRACE
+|10 col 11| invalid escape sequence: \q
+|12 col 11| invalid escape sequence: \q
+|13 col 9| unterminated string`
+
+	if got := errs.Error(); got != exp {
+		t.Fatalf("\nexp: %s\ngot: %s", exp, got)
+	}
+
+	// Statements that parsed are still returned.
+	expProg := "let y = 5;let f = fn() { };let t = 1;let u = 2;"
+	if got := prog.String(); got != expProg {
+		t.Fatalf("\nexp: %s\ngot: %s", expProg, got)
+	}
+}
+
+func TestParse_ExpressionConfig(t *testing.T) {
+	cfg := lexer.ExpressionConfig()
+
+	prog, err := parser.New(lexer.NewBytes("", []byte("if (a > 1) { a * 2 } else { -a }"), cfg)).Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if exp, got := "if (a > 1) { (a * 2); } else { (-a); };", prog.String(); got != exp {
+		t.Fatalf("\nexp: %s\ngot: %s", exp, got)
+	}
+
+	_, err = parser.New(lexer.NewBytes("", []byte("let x = 1"), cfg)).Parse()
+	if exp := "|1 col 5| expected SEMICOLON, got IDENT\n|1 col 7| invalid token: ="; err == nil || err.Error() != exp {
+		t.Fatalf("\nexp: %s\ngot: %v", exp, err)
+	}
+}
+
+func TestError_Pos(t *testing.T) {
+	code := "let s = 1;\n\tlet x = ;\nlet y = \"\U0001f600\" @;"
+
+	_, err := parser.Parse(code)
+	errs, ok := err.(parser.ErrorList)
+	if !ok || len(errs) != 2 {
+		t.Fatalf("exp 2 errors, got %v", err)
+	}
+
+	enc := lexer.NewPosEncoder([]byte(code), lexer.VisualColumns, 4)
+
+	tests := []struct {
+		err    *parser.Error
+		pos    lexer.Pos
+		visual lexer.Pos
+	}{
+		{errs[0], lexer.Pos{Offset: 20, Line: 2, Col: 10}, lexer.Pos{Offset: 20, Line: 2, Col: 13}},
+		{errs[1], lexer.Pos{Offset: -1, Line: 3, Col: 13}, lexer.Pos{Offset: -1, Line: 3, Col: 14}},
+	}
+
+	for _, test := range tests {
+		pos := test.err.Pos()
+		if pos != test.pos {
+			t.Fatalf("%s: exp %+v, got %+v", test.err, test.pos, pos)
+		}
+		if got := enc.Encode(pos); got != test.visual {
+			t.Fatalf("%s: exp visual %+v, got %+v", test.err, test.visual, got)
+		}
+	}
+
+	if pos := (&parser.Error{Err: errors.New("read failed")}).Pos(); pos != (lexer.Pos{}) {
+		t.Fatalf("exp zero Pos, got %+v", pos)
+	}
+}
+
+func TestParseFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "parser")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	file := filepath.Join(dir, "script.mky")
+	if err := ioutil.WriteFile(file, []byte("let x = 5;"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	fds := func() int {
+		fis, err := ioutil.ReadDir("/proc/self/fd")
+		if err != nil {
+			t.Skip("open files can't be counted:", err)
+		}
+		return len(fis)
+	}
+
+	before := fds()
+	for i := 0; i < 10; i++ {
+		prog, err := parser.ParseFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := prog.String(); got != "let x = 5;" {
+			t.Fatalf("exp %q, got %q", "let x = 5;", got)
+		}
+	}
+
+	// The file is closed after parsing.
+	if after := fds(); after > before {
+		t.Fatalf("exp %d open files, got %d", before, after)
+	}
+}
+
+func TestParse_ReaderError(t *testing.T) {
+	p := parser.New(lexer.New("", errReader{}))
+
+	_, err := p.Parse()
+
+	errs, ok := err.(parser.ErrorList)
+	if !ok || len(errs) != 1 {
+		t.Fatalf("exp a single error, got %v", err)
+	}
+}
+
+// errReader is an io.Reader that always fails.
+type errReader struct{}
+
+func (errReader) Read(p []byte) (int, error) { return 0, errors.New("read failed") }
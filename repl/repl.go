@@ -4,24 +4,27 @@ import (
 	"bufio"
 	"fmt"
 	"io"
-	"strings"
 
-	"github.com/dgnorton/monkey/lexer"
+	"github.com/dgnorton/monkey/eval"
+	"github.com/dgnorton/monkey/object"
+	"github.com/dgnorton/monkey/parser"
 )
 
 type REPL struct {
-	stdin  io.Reader
+	stdin  *bufio.Reader
 	stdout io.Writer
 	stderr io.Writer
 	prompt string
+	env    *object.Environment
 }
 
 func New(stdin io.Reader, stdout, stderr io.Writer) *REPL {
 	return &REPL{
-		stdin:  stdin,
+		stdin:  bufio.NewReader(stdin),
 		stdout: stdout,
 		stderr: stderr,
 		prompt: ">> ",
+		env:    object.NewEnvironment(),
 	}
 }
 
@@ -66,32 +69,30 @@ func (r *REPL) loop(stop chan struct{}, done chan struct{}) {
 
 func (r *REPL) read() (string, error) {
 	fmt.Fprint(r.stdout, r.prompt)
-	return bufio.NewReader(r.stdin).ReadString('\n')
+	return r.stdin.ReadString('\n')
 }
 
 func (r *REPL) eval(code string, stop chan struct{}) chan string {
 	ch := make(chan string)
 	go func() {
 		defer close(ch)
-		lex := lexer.New("", strings.NewReader(code))
-		for {
-			// See if we're supposed to exit.
-			select {
-			case <-stop:
-			default:
-			}
 
-			tok, err := lex.Next()
-			if err != nil {
-				ch <- err.Error()
-				return
-			}
+		prog, err := parser.Parse(code)
+		if err != nil {
+			ch <- err.Error()
+			return
+		}
 
-			ch <- fmt.Sprint(tok)
+		// See if we're supposed to exit.
+		select {
+		case <-stop:
+			return
+		default:
+		}
 
-			if tok.EOF() {
-				break
-			}
+		// Bindings persist in r.env across lines of input.
+		if result := eval.Eval(prog, r.env); result != nil {
+			ch <- result.Inspect()
 		}
 	}()
 	return ch
@@ -10,7 +10,7 @@ import (
 )
 
 func TestREPL(t *testing.T) {
-	stdin := strings.NewReader("let x = 42;\n")
+	stdin := strings.NewReader("let x = 42; x\nx * 2 + y\nlet f = fn(a) { a + x } f(1)\n")
 	stdoutr, stdoutw := io.Pipe()
 	_, stderrw := io.Pipe()
 
@@ -34,12 +34,9 @@ func TestREPL(t *testing.T) {
 		}
 	}()
 
-	exp := `>> &{LET  1 1 let 0}
-&{IDENT  1 5 x 0}
-&{ASSIGN  1 7 = 0}
-&{INT  1 9 42 42}
-&{SEMICOLON  1 11 ; 0}
-&{EOF  2 0  0}
+	exp := `>> 42
+>> |1 col 9| identifier not found: y
+>> 43
 >> `
 
 	// Wait for REPL results.